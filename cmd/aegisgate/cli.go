@@ -0,0 +1,151 @@
+package main
+
+import (
+	"AegisGate/internal/config"
+	"AegisGate/pkg/types"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// commands are the subcommands that talk to the admin API of a running gateway
+var commands = map[string]func(client *adminClient, args []string) error{
+	"reload":   runReload,
+	"versions": runVersions,
+	"rollback": runRollback,
+}
+
+// adminClient calls the admin API of a running gateway
+type adminClient struct {
+	baseURL string
+	auth    types.AdminAuthConfig
+	client  *http.Client
+}
+
+// runCommand runs a subcommand and returns the process exit code
+func runCommand(name string, args []string) int {
+	command := commands[name]
+
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	configPath := flags.String("config", defaultConfigPath(), "path of the gateway configuration file")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	// The admin address and credentials are read from the gateway configuration
+	adminConfig, err := config.LoadAdminConfig(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load configuration: %v\n", err)
+		return 1
+	}
+	if !adminConfig.Enabled {
+		fmt.Fprintln(os.Stderr, "The admin API is not enabled in the configuration")
+		return 1
+	}
+
+	client := &adminClient{
+		baseURL: "http://" + net.JoinHostPort(adminConfig.Host, strconv.Itoa(adminConfig.Port)),
+		auth:    adminConfig.Auth,
+		client:  &http.Client{Timeout: 30 * time.Second},
+	}
+
+	if err := command(client, flags.Args()); err != nil {
+		fmt.Fprintf(os.Stderr, "%s failed: %v\n", name, err)
+		return 1
+	}
+	return 0
+}
+
+// runReload makes the gateway reload its configuration file and reports any validation errors
+func runReload(client *adminClient, _ []string) error {
+	var result map[string]string
+	if err := client.do(http.MethodPost, "/reload", nil, &result); err != nil {
+		return err
+	}
+
+	fmt.Println("Configuration reloaded")
+	return nil
+}
+
+// runVersions prints the configuration versions retained by the gateway
+func runVersions(client *adminClient, _ []string) error {
+	var versions []config.Version
+	if err := client.do(http.MethodGet, "/config/versions", nil, &versions); err != nil {
+		return err
+	}
+
+	for _, version := range versions {
+		fmt.Printf("%d\t%s\t%s\t%s\n", version.Number, version.AppliedAt.Format(time.RFC3339), version.Hash[:12], version.Source)
+	}
+	return nil
+}
+
+// runRollback rolls the gateway back to the given version, or to the previous one
+func runRollback(client *adminClient, args []string) error {
+	req := map[string]int{}
+	if len(args) > 0 {
+		var number int
+		if _, err := fmt.Sscanf(args[0], "%d", &number); err != nil {
+			return fmt.Errorf("invalid version: %s", args[0])
+		}
+		req["version"] = number
+	}
+
+	var version config.Version
+	if err := client.do(http.MethodPost, "/config/rollback", req, &version); err != nil {
+		return err
+	}
+
+	fmt.Printf("Rolled back, configuration version %d applied (%s)\n", version.Number, version.Source)
+	return nil
+}
+
+// do sends a request to the admin API and decodes the JSON response into out
+func (c *adminClient) do(method, path string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, c.baseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	if c.auth.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.auth.Token)
+	} else {
+		req.SetBasicAuth(c.auth.Username, c.auth.Password)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Error            string   `json:"error"`
+			ValidationErrors []string `json:"validation_errors"`
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&apiErr)
+		message := apiErr.Error
+		for _, validationErr := range apiErr.ValidationErrors {
+			message += "\n  - " + validationErr
+		}
+		return fmt.Errorf("admin API responded with %s: %s", resp.Status, message)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(out)
+}
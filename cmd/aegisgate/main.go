@@ -1,90 +1,235 @@
 package main
 
 import (
+	"AegisGate/internal/admin"
 	"AegisGate/internal/logger"
+	"AegisGate/internal/upgrade"
 	"AegisGate/internal/watcher"
+	"context"
 	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"slices"
 	"syscall"
+	"time"
 
 	"AegisGate/internal/config"
 	"AegisGate/internal/core"
 )
 
-// handleShutdown sets up signal handling and graceful shutdown
-func handleShutdown(g *core.Gateway, w *watcher.ConfigWatcher, l *logger.Logger) {
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+// Process exit codes
+const (
+	exitOK           = 0 // Shut down cleanly after draining all requests
+	exitFailure      = 1 // Failed to start or a server stopped unexpectedly
+	exitDrainTimeout = 3 // Connections were closed forcibly because draining took too long
+)
 
-	go func() {
-		sig := <-sigChan
-		l.Info("Received signal %v, shutting down gateway...", sig)
+// defaultConfigPath returns the config file path from the environment or the default value
+func defaultConfigPath() string {
+	if configPath := os.Getenv("CONFIG_PATH"); configPath != "" {
+		return configPath
+	}
+	return "config.yaml"
+}
 
-		// Close the config watcher
-		if err := w.Close(); err != nil {
-			l.Error("Error closing config watcher: %v", err)
+func main() {
+	// Run a subcommand against a running gateway if one was given
+	if len(os.Args) > 1 {
+		if _, ok := commands[os.Args[1]]; ok {
+			os.Exit(runCommand(os.Args[1], os.Args[2:]))
 		}
-		l.Debug("Config watcher closed")
+	}
 
-		if err := g.Close(); err != nil {
-			l.Error("Error during shutdown: %v", err)
-		}
-		l.Debug("Gateway closed")
-		l.Debug("Exiting...")
-		os.Exit(0)
-	}()
+	os.Exit(run())
 }
 
-func main() {
+// run starts the gateway and blocks until it has shut down, returning the process exit code
+func run() int {
 	// Get config file path from environment or use default value
-	configPath := os.Getenv("CONFIG_PATH")
-	if configPath == "" {
-		configPath = "config.yaml"
-	}
+	configPath := defaultConfigPath()
 
 	// Load the configuration
-	cfg, err := config.LoadConfig(configPath)
+	cfg, hash, err := config.Load(configPath)
 	if err != nil {
-		log.Fatalf("Failed to load configuration: %v", err)
+		log.Printf("Failed to load configuration: %v", err)
+		return exitFailure
 	}
 
 	// Create the logger
 	l := logger.New(cfg.Server.Debug)
 
+	// Listeners are inherited from a parent process during an upgrade or from
+	// systemd socket activation, and handed over to the next process on upgrade.
+	// This must happen before any other file is opened, since the inherited
+	// descriptors are identified by number.
+	upgrader, err := upgrade.New(l)
+	if err != nil {
+		l.Error("Failed to inherit listeners: %v", err)
+		return exitFailure
+	}
+	processUpgrader := newProcessUpgrader(upgrader)
+
 	// Create the gateway
 	gateway, err := core.New(cfg)
 	if err != nil {
-		log.Panicf("Failed to create gateway: %v", err)
+		l.Error("Failed to create gateway: %v", err)
+		return exitFailure
 	}
-	defer func(gateway *core.Gateway) {
-		err := gateway.Close()
-		if err != nil {
-			log.Printf("Error during shutdown: %v", err)
-		}
-	}(gateway)
 
 	// Initialize config watcher
-	configWatcher, err := watcher.New(configPath, l)
+	configWatcher, err := watcher.New(configPath, cfg, hash, l)
 	if err != nil {
-		log.Fatalf("Failed to create config watcher: %v", err)
+		l.Error("Failed to create config watcher: %v", err)
+		return exitFailure
 	}
-	defer func(configWatcher *watcher.ConfigWatcher) {
-		err := configWatcher.Close()
-		if err != nil {
-			log.Printf("Error closing config watcher: %v", err)
-		}
-	}(configWatcher)
 	configWatcher.RegisterHandler(gateway)
 
-	// Set up shutdown handling
-	handleShutdown(gateway, configWatcher, l)
+	// Listen for signals before starting the servers so that none are missed
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, append([]os.Signal{syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP}, upgradeSignals...)...)
+	defer signal.Stop(sigChan)
+
+	// Bind all listeners before reporting readiness
+	gateway.SetListenFunc(upgrader.Listen)
+	gateway.SetListenPacketFunc(upgrader.ListenPacket)
+	if err := gateway.Listen(); err != nil {
+		l.Error("%v", err)
+		return exitFailure
+	}
+
+	var adminServer *admin.Server
+	if cfg.Admin.Enabled {
+		adminServer = admin.New(cfg.Admin, gateway, configWatcher, l)
+		adminServer.SetUpgrader(processUpgrader)
+		adminServer.SetListenFunc(upgrader.Listen)
+		gateway.SetPurgeAuthorizer(adminServer.Authorized)
+		if err := adminServer.Listen(); err != nil {
+			l.Error("%v", err)
+			_ = gateway.Close()
+			return exitFailure
+		}
+	}
+
+	serverErr := make(chan error, 2)
+
+	// Start the admin API if enabled
+	if adminServer != nil {
+		go func() {
+			if err := adminServer.Serve(); !errors.Is(err, http.ErrServerClosed) {
+				serverErr <- fmt.Errorf("admin API server failed: %w", err)
+			}
+		}()
+	}
 
 	// Start the gateway
-	err = gateway.Start()
-	if !errors.Is(http.ErrServerClosed, err) {
-		log.Fatalf("Gateway server failed: %v", err)
+	go func() {
+		if err := gateway.Serve(); !errors.Is(err, http.ErrServerClosed) {
+			serverErr <- fmt.Errorf("gateway server failed: %w", err)
+		}
+	}()
+
+	// Tell the parent process, if any, that it can drain and exit
+	if err := upgrader.Ready(); err != nil {
+		l.Error("%v", err)
 	}
+
+	// Handle reloads and upgrades until a shutdown signal arrives or a server fails
+	for {
+		select {
+		case err := <-serverErr:
+			l.Error("%v", err)
+			_ = configWatcher.Close()
+			_ = gateway.Close()
+			return exitFailure
+		case <-processUpgrader.Done():
+			l.Info("New process took over the listeners, shutting down gateway...")
+			return shutdown(gateway, configWatcher, adminServer, sigChan, false, l)
+		case sig := <-sigChan:
+			switch {
+			case sig == syscall.SIGHUP:
+				l.Info("Received signal %v, reloading configuration...", sig)
+				if err := configWatcher.Reload(); err != nil {
+					l.Error("%v", err)
+				}
+			case slices.Contains(upgradeSignals, sig):
+				l.Info("Received signal %v, upgrading to a new process...", sig)
+				go func() {
+					if err := processUpgrader.Upgrade(); err != nil {
+						l.Error("Upgrade failed: %v", err)
+					}
+				}()
+			default:
+				l.Info("Received signal %v, shutting down gateway...", sig)
+				return shutdown(gateway, configWatcher, adminServer, sigChan, true, l)
+			}
+		}
+	}
+}
+
+// shutdown performs an orderly shutdown: it fails readiness, waits for the
+// pre-stop delay so that load balancers stop sending traffic, then drains
+// in-flight requests until the drain timeout. The pre-stop delay is skipped
+// after an upgrade, since the new process already accepts connections on the
+// same sockets. A second shutdown signal skips the remaining wait and closes
+// all connections.
+func shutdown(g *core.Gateway, w *watcher.ConfigWatcher, a *admin.Server, sigChan <-chan os.Signal, preStop bool, l *logger.Logger) int {
+	shutdownConfig := g.Config().Server.Shutdown
+
+	// Close the config watcher so that no reload races the shutdown
+	if err := w.Close(); err != nil {
+		l.Error("Error closing config watcher: %v", err)
+	}
+	l.Debug("Config watcher closed")
+
+	g.SetReady(false)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		for {
+			select {
+			case sig := <-sigChan:
+				if sig != syscall.SIGINT && sig != syscall.SIGTERM {
+					continue
+				}
+				l.Info("Received signal %v again, closing all connections", sig)
+				cancel()
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	if preStop && shutdownConfig.PreStopDelay > 0 {
+		l.Info("Readiness failed, waiting %v before draining connections", shutdownConfig.PreStopDelay)
+		select {
+		case <-time.After(shutdownConfig.PreStopDelay.Std()):
+		case <-ctx.Done():
+		}
+	}
+
+	drainCtx, drainCancel := context.WithTimeout(ctx, shutdownConfig.DrainTimeout.Std())
+	defer drainCancel()
+
+	l.Info("Draining connections for up to %v", shutdownConfig.DrainTimeout)
+	exitCode := exitOK
+	if err := g.Shutdown(drainCtx); err != nil {
+		l.Error("Error during shutdown: %v", err)
+		exitCode = exitDrainTimeout
+	}
+	l.Debug("Gateway closed")
+
+	if a != nil {
+		if err := a.Shutdown(drainCtx); err != nil {
+			l.Error("Error closing admin API server: %v", err)
+		}
+		l.Debug("Admin API server closed")
+	}
+
+	l.Info("Shutdown complete")
+	return exitCode
 }
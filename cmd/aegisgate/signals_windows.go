@@ -0,0 +1,8 @@
+//go:build windows
+
+package main
+
+import "os"
+
+// upgradeSignals trigger a zero-downtime upgrade to a new process, which is not supported on Windows
+var upgradeSignals []os.Signal
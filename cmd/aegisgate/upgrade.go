@@ -0,0 +1,47 @@
+package main
+
+import (
+	"AegisGate/internal/upgrade"
+	"context"
+	"sync"
+	"time"
+)
+
+// upgradeTimeout is how long a new process may take to become ready during an upgrade
+const upgradeTimeout = 30 * time.Second
+
+// processUpgrader hands the listeners over to a new process and, once it is
+// ready, signals that this process should drain and exit
+type processUpgrader struct {
+	upgrader *upgrade.Upgrader
+	done     chan struct{}
+	once     sync.Once
+}
+
+// newProcessUpgrader creates a new processUpgrader
+func newProcessUpgrader(upgrader *upgrade.Upgrader) *processUpgrader {
+	return &processUpgrader{
+		upgrader: upgrader,
+		done:     make(chan struct{}),
+	}
+}
+
+// Upgrade starts the new process and waits until it is ready
+func (p *processUpgrader) Upgrade() error {
+	ctx, cancel := context.WithTimeout(context.Background(), upgradeTimeout)
+	defer cancel()
+
+	if err := p.upgrader.Upgrade(ctx); err != nil {
+		return err
+	}
+
+	p.once.Do(func() {
+		close(p.done)
+	})
+	return nil
+}
+
+// Done is closed once a new process has taken over the listeners
+func (p *processUpgrader) Done() <-chan struct{} {
+	return p.done
+}
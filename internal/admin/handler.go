@@ -0,0 +1,232 @@
+package admin
+
+import (
+	"AegisGate/internal/config"
+	"AegisGate/internal/core"
+	"AegisGate/internal/metrics"
+	"AegisGate/pkg/types"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/julienschmidt/httprouter"
+	"gopkg.in/yaml.v3"
+)
+
+// redactedSecret replaces credentials in the config returned by the admin API
+const redactedSecret = "[REDACTED]"
+
+// toggleRouteRequest is the body of a route toggle request
+type toggleRouteRequest struct {
+	Method  string `json:"method"`
+	Path    string `json:"path"`
+	Enabled bool   `json:"enabled"`
+}
+
+// rollbackRequest is the body of a rollback request
+type rollbackRequest struct {
+	Version int `json:"version"`
+}
+
+// handleConfig returns the effective configuration as YAML
+func (s *Server) handleConfig(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+	writeConfig(w, s.gateway.Config())
+}
+
+// handleVersions returns the retained configuration versions
+func (s *Server) handleVersions(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+	writeJSON(w, http.StatusOK, s.configs.Versions())
+}
+
+// handleVersion returns the configuration of a retained version as YAML
+func (s *Server) handleVersion(w http.ResponseWriter, _ *http.Request, ps httprouter.Params) {
+	number, err := strconv.Atoi(ps.ByName("version"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid version: "+ps.ByName("version"))
+		return
+	}
+
+	version, err := s.configs.Version(number)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	writeConfig(w, version.Config)
+}
+
+// handleRollback re-applies a previous configuration version. Without a
+// version in the body, the version before the current one is applied.
+func (s *Server) handleRollback(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	var req rollbackRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return
+	}
+
+	s.logger.Info("Rollback requested through admin API")
+	version, err := s.configs.Rollback(req.Version)
+	if err != nil {
+		s.logger.Error("Rollback failed: %v", err)
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, version)
+}
+
+// writeConfig writes a configuration as a YAML response with the admin credentials redacted
+func writeConfig(w http.ResponseWriter, cfg *types.Config) {
+	config := *cfg
+	if config.Admin.Auth.Token != "" {
+		config.Admin.Auth.Token = redactedSecret
+	}
+	if config.Admin.Auth.Password != "" {
+		config.Admin.Auth.Password = redactedSecret
+	}
+
+	data, err := yaml.Marshal(config)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/yaml")
+	_, _ = w.Write(data)
+}
+
+// handleRoutes returns the registered routes
+func (s *Server) handleRoutes(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+	writeJSON(w, http.StatusOK, s.gateway.Routes())
+}
+
+// handleToggleRoute enables or disables a route
+func (s *Server) handleToggleRoute(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	var req toggleRouteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return
+	}
+
+	if err := s.gateway.SetRouteEnabled(req.Method, req.Path, req.Enabled); err != nil {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, req)
+}
+
+// handlePurgeCache removes the cached responses selected by the request body
+func (s *Server) handlePurgeCache(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	var req core.CachePurge
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return
+	}
+
+	selectors := 0
+	for _, selector := range []string{req.Key, req.Prefix, req.Tag} {
+		if selector != "" {
+			selectors++
+		}
+	}
+	if selectors > 1 {
+		writeError(w, http.StatusBadRequest, "only one of key, prefix and tag may be set")
+		return
+	}
+	if selectors == 0 && req.Service == "" {
+		writeError(w, http.StatusBadRequest, "a service, key, prefix or tag is required")
+		return
+	}
+
+	purged, err := s.gateway.PurgeCache(req)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]int{"purged": purged})
+}
+
+// handleTargets returns the health and circuit breaker state of every target
+func (s *Server) handleTargets(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+	writeJSON(w, http.StatusOK, s.gateway.Targets())
+}
+
+// handleDrainTarget returns a handler that drains or restores the target of a service
+func (s *Server) handleDrainTarget(drained bool) httprouter.Handle {
+	return func(w http.ResponseWriter, _ *http.Request, ps httprouter.Params) {
+		service := ps.ByName("service")
+		if err := s.gateway.SetTargetDrained(service, drained); err != nil {
+			writeError(w, http.StatusNotFound, err.Error())
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]interface{}{"service": service, "drained": drained})
+	}
+}
+
+// handleReload reloads the configuration file synchronously, so that the
+// caller learns whether the new configuration was applied. An invalid
+// configuration is answered with every validation error found.
+func (s *Server) handleReload(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+	s.logger.Info("Reload requested through admin API")
+	err := s.configs.Reload()
+	if err == nil {
+		writeJSON(w, http.StatusOK, map[string]string{"status": "reloaded"})
+		return
+	}
+
+	s.logger.Error("%v", err)
+
+	var validationErr *config.ValidationError
+	if errors.As(err, &validationErr) {
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]interface{}{
+			"error":             "invalid configuration",
+			"validation_errors": validationErr.Errors,
+		})
+		return
+	}
+
+	writeError(w, http.StatusInternalServerError, err.Error())
+}
+
+// handleUpgrade starts a new gateway process that takes over the listeners and
+// answers once it is ready. This process then drains and exits.
+func (s *Server) handleUpgrade(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+	if s.upgrader == nil {
+		writeError(w, http.StatusNotImplemented, "upgrades are not supported")
+		return
+	}
+
+	s.logger.Info("Upgrade requested through admin API")
+	if err := s.upgrader.Upgrade(); err != nil {
+		s.logger.Error("Upgrade failed: %v", err)
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"status": "upgraded"})
+}
+
+// handleMetrics returns the gateway metrics in the Prometheus text format
+func (s *Server) handleMetrics(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	if err := metrics.WriteText(w); err != nil {
+		s.logger.Error("Failed to write metrics: %v", err)
+	}
+}
+
+// writeJSON writes v as a JSON response
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes an error message as a JSON response
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
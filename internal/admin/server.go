@@ -0,0 +1,148 @@
+package admin
+
+import (
+	"AegisGate/internal/config"
+	"AegisGate/internal/core"
+	"AegisGate/internal/logger"
+	"AegisGate/pkg/types"
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// ConfigManager reloads the gateway configuration on demand and keeps track
+// of the configuration versions that have been applied
+type ConfigManager interface {
+	Reload() error
+	Rollback(number int) (*config.Version, error)
+	Versions() []config.Version
+	Version(number int) (*config.Version, error)
+}
+
+// Upgrader replaces the running gateway process with a new one
+type Upgrader interface {
+	Upgrade() error
+}
+
+// Server exposes the admin API for runtime inspection and control
+type Server struct {
+	config   types.AdminConfig
+	gateway  *core.Gateway
+	configs  ConfigManager
+	upgrader Upgrader
+	router   *httprouter.Router
+	server   *http.Server
+	listener net.Listener
+	listen   core.ListenFunc
+	logger   *logger.Logger
+}
+
+// New creates a new admin Server
+func New(config types.AdminConfig, gateway *core.Gateway, configs ConfigManager, l *logger.Logger) *Server {
+	s := &Server{
+		config:  config,
+		gateway: gateway,
+		configs: configs,
+		router:  httprouter.New(),
+		listen: func(_, network, address string) (net.Listener, error) {
+			return net.Listen(network, address)
+		},
+		logger: l,
+	}
+
+	s.initializeRoutes()
+
+	s.server = &http.Server{
+		Addr:    net.JoinHostPort(config.Host, strconv.Itoa(config.Port)),
+		Handler: s.authenticate(s.router),
+	}
+
+	return s
+}
+
+// initializeRoutes sets up the admin API routes
+func (s *Server) initializeRoutes() {
+	s.router.GET("/config", s.handleConfig)
+	s.router.GET("/config/versions", s.handleVersions)
+	s.router.GET("/config/versions/:version", s.handleVersion)
+	s.router.POST("/config/rollback", s.handleRollback)
+	s.router.GET("/routes", s.handleRoutes)
+	s.router.POST("/routes/toggle", s.handleToggleRoute)
+	s.router.GET("/targets", s.handleTargets)
+	s.router.POST("/targets/:service/drain", s.handleDrainTarget(true))
+	s.router.POST("/targets/:service/undrain", s.handleDrainTarget(false))
+	s.router.POST("/cache/purge", s.handlePurgeCache)
+	s.router.GET("/metrics", s.handleMetrics)
+	s.router.POST("/reload", s.handleReload)
+	s.router.POST("/upgrade", s.handleUpgrade)
+}
+
+// SetUpgrader sets the upgrader used by the upgrade endpoint
+func (s *Server) SetUpgrader(upgrader Upgrader) {
+	s.upgrader = upgrader
+}
+
+// SetListenFunc sets the function used to create the admin API listener
+func (s *Server) SetListenFunc(listen core.ListenFunc) {
+	s.listen = listen
+}
+
+// Listen binds the admin API listener
+func (s *Server) Listen() error {
+	ln, err := s.listen("admin", "tcp", s.server.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", s.server.Addr, err)
+	}
+	s.listener = ln
+	return nil
+}
+
+// Serve accepts connections on the listener bound by Listen
+func (s *Server) Serve() error {
+	s.logger.Info("Starting admin API server on %s", s.listener.Addr())
+	return s.server.Serve(s.listener)
+}
+
+// authenticate rejects requests that do not carry the configured admin credentials
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.Authorized(r) {
+			if s.config.Auth.Token == "" {
+				w.Header().Set("WWW-Authenticate", `Basic realm="AegisGate Admin"`)
+			}
+			writeError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Authorized reports whether the request carries valid admin credentials
+func (s *Server) Authorized(r *http.Request) bool {
+	auth := s.config.Auth
+
+	if auth.Token != "" {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		return ok && secureCompare(token, auth.Token)
+	}
+
+	username, password, ok := r.BasicAuth()
+	return ok && secureCompare(username, auth.Username) && secureCompare(password, auth.Password)
+}
+
+// secureCompare compares two strings in constant time
+func secureCompare(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// Shutdown gracefully shuts down the admin API server
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.logger.Debug("Shutting down admin API server")
+	return s.server.Shutdown(ctx)
+}
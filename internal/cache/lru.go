@@ -0,0 +1,133 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+)
+
+// LRU is an in-memory store limited by the total size of its values. Adding
+// a value beyond the limit evicts the least recently used ones.
+type LRU[V any] struct {
+	mu      sync.Mutex
+	maxSize int64
+	size    int64
+	order   *list.List // Front is the most recently used
+	items   map[string]*list.Element
+}
+
+// lruItem is a value held by an LRU
+type lruItem[V any] struct {
+	key   string
+	value V
+	size  int64
+}
+
+// NewLRU creates an LRU holding up to maxSize bytes
+func NewLRU[V any](maxSize int64) *LRU[V] {
+	return &LRU[V]{
+		maxSize: maxSize,
+		order:   list.New(),
+		items:   make(map[string]*list.Element),
+	}
+}
+
+// Get returns the value stored under key and marks it as recently used
+func (c *LRU[V]) Get(key string) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, exists := c.items[key]
+	if !exists {
+		var zero V
+		return zero, false
+	}
+	c.order.MoveToFront(element)
+	return element.Value.(*lruItem[V]).value, true
+}
+
+// Set stores value under key, replacing any previous value. Values larger
+// than the whole store are not stored.
+func (c *LRU[V]) Set(key string, value V, size int64) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, exists := c.items[key]; exists {
+		c.remove(element)
+	}
+	if size > c.maxSize {
+		return false
+	}
+
+	c.items[key] = c.order.PushFront(&lruItem[V]{key: key, value: value, size: size})
+	c.size += size
+	c.evict()
+	return true
+}
+
+// Delete removes the value stored under key
+func (c *LRU[V]) Delete(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, exists := c.items[key]
+	if exists {
+		c.remove(element)
+	}
+	return exists
+}
+
+// DeleteFunc removes the values for which match returns true and returns
+// how many were removed
+func (c *LRU[V]) DeleteFunc(match func(key string, value V) bool) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	removed := 0
+	for element := c.order.Front(); element != nil; {
+		next := element.Next()
+		item := element.Value.(*lruItem[V])
+		if match(item.key, item.value) {
+			c.remove(element)
+			removed++
+		}
+		element = next
+	}
+	return removed
+}
+
+// SetMaxSize changes the size limit, evicting values if the store shrinks
+func (c *LRU[V]) SetMaxSize(maxSize int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.maxSize = maxSize
+	c.evict()
+}
+
+// Len returns the number of stored values
+func (c *LRU[V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.items)
+}
+
+// Size returns the total size of the stored values
+func (c *LRU[V]) Size() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.size
+}
+
+// evict removes the least recently used values until the store fits its limit
+func (c *LRU[V]) evict() {
+	for c.size > c.maxSize {
+		c.remove(c.order.Back())
+	}
+}
+
+// remove drops an element from the store
+func (c *LRU[V]) remove(element *list.Element) {
+	item := c.order.Remove(element).(*lruItem[V])
+	delete(c.items, item.key)
+	c.size -= item.size
+}
@@ -0,0 +1,171 @@
+package config
+
+import (
+	"AegisGate/pkg/types"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Diff describes the differences between two configurations
+type Diff struct {
+	ServerChanged   bool          `json:"server_changed"`
+	AdminChanged    bool          `json:"admin_changed"`
+	L4Changed       bool          `json:"l4_services_changed"` // TCP or UDP services changed
+	ServicesAdded   []string      `json:"services_added,omitempty"`
+	ServicesRemoved []string      `json:"services_removed,omitempty"`
+	ServicesChanged []ServiceDiff `json:"services_changed,omitempty"`
+}
+
+// ServiceDiff describes the differences between two versions of a service
+type ServiceDiff struct {
+	Name          string   `json:"name"`
+	Fields        []string `json:"fields,omitempty"`
+	RoutesAdded   []string `json:"routes_added,omitempty"`
+	RoutesRemoved []string `json:"routes_removed,omitempty"`
+	RoutesChanged []string `json:"routes_changed,omitempty"`
+}
+
+// DiffConfigs compares two configurations. Services are matched by name and
+// routes by path.
+func DiffConfigs(oldConfig, newConfig *types.Config) Diff {
+	diff := Diff{
+		ServerChanged: !reflect.DeepEqual(oldConfig.Server, newConfig.Server),
+		AdminChanged:  !reflect.DeepEqual(oldConfig.Admin, newConfig.Admin),
+		L4Changed: !reflect.DeepEqual(oldConfig.TCPServices, newConfig.TCPServices) ||
+			!reflect.DeepEqual(oldConfig.UDPServices, newConfig.UDPServices),
+	}
+
+	oldServices := make(map[string]types.ServiceConfig)
+	for _, service := range oldConfig.Services {
+		oldServices[service.Name] = service
+	}
+
+	newServices := make(map[string]bool)
+	for _, service := range newConfig.Services {
+		newServices[service.Name] = true
+
+		oldService, exists := oldServices[service.Name]
+		if !exists {
+			diff.ServicesAdded = append(diff.ServicesAdded, service.Name)
+			continue
+		}
+
+		if serviceDiff := diffService(oldService, service); serviceDiff != nil {
+			diff.ServicesChanged = append(diff.ServicesChanged, *serviceDiff)
+		}
+	}
+
+	for _, service := range oldConfig.Services {
+		if !newServices[service.Name] {
+			diff.ServicesRemoved = append(diff.ServicesRemoved, service.Name)
+		}
+	}
+
+	return diff
+}
+
+// diffService compares two versions of a service, returning nil if they are equal
+func diffService(oldService, newService types.ServiceConfig) *ServiceDiff {
+	if reflect.DeepEqual(oldService, newService) {
+		return nil
+	}
+
+	diff := &ServiceDiff{Name: newService.Name}
+
+	// Compare every setting except the routes, which are compared one by one
+	oldValue := reflect.ValueOf(oldService)
+	newValue := reflect.ValueOf(newService)
+	for i := 0; i < oldValue.NumField(); i++ {
+		field := oldValue.Type().Field(i)
+		if field.Name == "Routes" {
+			continue
+		}
+		if !reflect.DeepEqual(oldValue.Field(i).Interface(), newValue.Field(i).Interface()) {
+			diff.Fields = append(diff.Fields, yamlName(field))
+		}
+	}
+
+	oldRoutes := make(map[string]types.Route)
+	for _, route := range oldService.Routes {
+		oldRoutes[route.Path] = route
+	}
+
+	newRoutes := make(map[string]bool)
+	for _, route := range newService.Routes {
+		newRoutes[route.Path] = true
+
+		oldRoute, exists := oldRoutes[route.Path]
+		switch {
+		case !exists:
+			diff.RoutesAdded = append(diff.RoutesAdded, route.Path)
+		case !reflect.DeepEqual(oldRoute, route):
+			diff.RoutesChanged = append(diff.RoutesChanged, route.Path)
+		}
+	}
+
+	for _, route := range oldService.Routes {
+		if !newRoutes[route.Path] {
+			diff.RoutesRemoved = append(diff.RoutesRemoved, route.Path)
+		}
+	}
+
+	return diff
+}
+
+// yamlName returns the YAML key of a struct field
+func yamlName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
+
+// Empty reports whether the configurations were equal
+func (d Diff) Empty() bool {
+	return !d.ServerChanged && !d.AdminChanged && !d.L4Changed &&
+		len(d.ServicesAdded) == 0 && len(d.ServicesRemoved) == 0 && len(d.ServicesChanged) == 0
+}
+
+// String returns a single line summary of the differences
+func (d Diff) String() string {
+	if d.Empty() {
+		return "no changes"
+	}
+
+	parts := make([]string, 0)
+	if d.ServerChanged {
+		parts = append(parts, "server settings changed")
+	}
+	if d.AdminChanged {
+		parts = append(parts, "admin settings changed")
+	}
+	if d.L4Changed {
+		parts = append(parts, "tcp or udp services changed")
+	}
+	if len(d.ServicesAdded) > 0 {
+		parts = append(parts, fmt.Sprintf("services added %v", d.ServicesAdded))
+	}
+	if len(d.ServicesRemoved) > 0 {
+		parts = append(parts, fmt.Sprintf("services removed %v", d.ServicesRemoved))
+	}
+	for _, service := range d.ServicesChanged {
+		changes := make([]string, 0)
+		if len(service.Fields) > 0 {
+			changes = append(changes, fmt.Sprintf("fields %v", service.Fields))
+		}
+		if len(service.RoutesAdded) > 0 {
+			changes = append(changes, fmt.Sprintf("routes added %v", service.RoutesAdded))
+		}
+		if len(service.RoutesRemoved) > 0 {
+			changes = append(changes, fmt.Sprintf("routes removed %v", service.RoutesRemoved))
+		}
+		if len(service.RoutesChanged) > 0 {
+			changes = append(changes, fmt.Sprintf("routes changed %v", service.RoutesChanged))
+		}
+		parts = append(parts, fmt.Sprintf("service %s changed (%s)", service.Name, strings.Join(changes, ", ")))
+	}
+
+	return strings.Join(parts, "; ")
+}
@@ -0,0 +1,128 @@
+package config
+
+import (
+	"AegisGate/pkg/types"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// defaultHistorySize is the number of configuration versions kept for rollback
+const defaultHistorySize = 20
+
+// Version is a configuration that has been applied to the gateway
+type Version struct {
+	Number          int           `json:"version"`
+	Hash            string        `json:"hash"`
+	AppliedAt       time.Time     `json:"applied_at"`
+	Source          string        `json:"source"`
+	RestoredVersion int           `json:"restored_version,omitempty"` // Version re-applied by a rollback
+	Config          *types.Config `json:"-"`
+}
+
+// History records the configuration versions applied to the gateway
+type History struct {
+	mu       sync.RWMutex
+	versions []*Version
+	size     int
+	next     int
+}
+
+// NewHistory creates a new History keeping the most recent versions
+func NewHistory() *History {
+	return &History{
+		versions: make([]*Version, 0),
+		size:     defaultHistorySize,
+		next:     1,
+	}
+}
+
+// Record stores an applied configuration as a new version. Rollbacks pass the
+// number of the version they re-applied as restored, other changes 0.
+func (h *History) Record(config *types.Config, hash, source string, restored int) *Version {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	version := &Version{
+		Number:          h.next,
+		Hash:            hash,
+		AppliedAt:       time.Now(),
+		Source:          source,
+		RestoredVersion: restored,
+		Config:          config,
+	}
+	h.next++
+
+	h.versions = append(h.versions, version)
+	if len(h.versions) > h.size {
+		h.versions = h.versions[len(h.versions)-h.size:]
+	}
+
+	return version
+}
+
+// Current returns the most recently applied version, or nil if none was recorded
+func (h *History) Current() *Version {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	if len(h.versions) == 0 {
+		return nil
+	}
+	return h.versions[len(h.versions)-1]
+}
+
+// Previous returns the version to roll back to from the current one: the
+// most recent version older than the configuration in effect. A rollback is
+// in effect as the version it restored, so that repeated rollbacks keep going
+// back instead of alternating between two versions.
+func (h *History) Previous() (*Version, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	if len(h.versions) == 0 {
+		return nil, fmt.Errorf("no previous configuration version available")
+	}
+
+	current := h.versions[len(h.versions)-1].Original()
+	for i := len(h.versions) - 2; i >= 0; i-- {
+		if h.versions[i].Original() < current {
+			return h.versions[i], nil
+		}
+	}
+	return nil, fmt.Errorf("no previous configuration version available")
+}
+
+// Original returns the number of the version whose configuration a version
+// applied, which differs from its own for rollbacks
+func (v *Version) Original() int {
+	if v.RestoredVersion != 0 {
+		return v.RestoredVersion
+	}
+	return v.Number
+}
+
+// Get returns the version with the given number
+func (h *History) Get(number int) (*Version, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for _, version := range h.versions {
+		if version.Number == number {
+			return version, nil
+		}
+	}
+	return nil, fmt.Errorf("configuration version %d not found", number)
+}
+
+// List returns all retained versions, oldest first
+func (h *History) List() []Version {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	versions := make([]Version, len(h.versions))
+	for i, version := range h.versions {
+		versions[i] = *version
+	}
+	return versions
+}
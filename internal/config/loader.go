@@ -1,8 +1,11 @@
 package config
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"os"
+	"time"
 
 	"AegisGate/pkg/types"
 	"gopkg.in/yaml.v3"
@@ -10,20 +13,174 @@ import (
 
 // LoadConfig loads the configuration from a YAML file
 func LoadConfig(path string) (*types.Config, error) {
+	config, _, err := Load(path)
+	return config, err
+}
+
+// Load loads the configuration from a YAML file and returns it together with
+// the hash of the file contents
+func Load(path string) (*types.Config, string, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read config file: %w", err)
+		return nil, "", fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	config, err := ParseConfig(data)
+	if err != nil {
+		return nil, "", err
 	}
 
+	return config, Hash(data), nil
+}
+
+// ParseConfig parses and validates the configuration from YAML data
+func ParseConfig(data []byte) (*types.Config, error) {
 	config := &types.Config{}
 
 	if err := yaml.Unmarshal(data, config); err != nil {
-		return nil, fmt.Errorf("failed to parse config file: %w", err)
+		return nil, fmt.Errorf("failed to parse config file: %w", &ValidationError{Errors: []string{err.Error()}})
 	}
 
+	applyDefaults(config)
+
 	if err := validateConfig(config); err != nil {
 		return nil, fmt.Errorf("invalid configuration: %w", err)
 	}
 
 	return config, nil
 }
+
+// LoadAdminConfig reads the admin settings from a YAML file without validating
+// the rest of the configuration, so that the admin API of a running gateway can
+// be reached while the file holds a configuration that is not valid yet
+func LoadAdminConfig(path string) (types.AdminConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return types.AdminConfig{}, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	config := &types.Config{}
+	if err := yaml.Unmarshal(data, config); err != nil {
+		return types.AdminConfig{}, fmt.Errorf("failed to parse config file: %w", err)
+	}
+
+	applyDefaults(config)
+
+	if err := validateAdmin(config.Admin); err != nil {
+		return types.AdminConfig{}, fmt.Errorf("invalid admin configuration: %w", err)
+	}
+
+	return config.Admin, nil
+}
+
+// Hash returns the SHA-256 hash of the configuration file contents
+func Hash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// applyDefaults fills in optional settings that were left empty
+func applyDefaults(config *types.Config) {
+	if config.Admin.Host == "" {
+		config.Admin.Host = "127.0.0.1"
+	}
+	if config.Admin.Port == 0 {
+		config.Admin.Port = 9901
+	}
+	for i := range config.Server.Listeners {
+		if config.Server.Listeners[i].Protocol == "" {
+			config.Server.Listeners[i].Protocol = types.ProtocolHTTP
+		}
+		if proxyProtocol := &config.Server.Listeners[i].ProxyProtocol; proxyProtocol.Enabled && proxyProtocol.HeaderTimeout == 0 {
+			proxyProtocol.HeaderTimeout = types.Duration(5 * time.Second)
+		}
+		if http3 := &config.Server.Listeners[i].HTTP3; http3.Enabled {
+			if http3.Address == "" {
+				http3.Address = config.Server.Listeners[i].Address
+			}
+			if http3.AltSvcMaxAge == 0 {
+				http3.AltSvcMaxAge = types.Duration(24 * time.Hour)
+			}
+		}
+	}
+	for i := range config.Services {
+		if config.Services[i].Protocol == "" {
+			config.Services[i].Protocol = types.ServiceProtocolHTTP
+		}
+		if breaker := &config.Services[i].CircuitBreaker; breaker.Enabled {
+			applyCircuitBreakerDefaults(breaker)
+			if len(breaker.FailureStatuses) == 0 {
+				breaker.FailureStatuses = types.DefaultCircuitBreakerFailureStatuses
+			}
+		}
+		for j := range config.Services[i].Routes {
+			if compression := &config.Services[i].Routes[j].Compression; compression.Enabled {
+				if len(compression.Algorithms) == 0 {
+					compression.Algorithms = []string{types.EncodingZstd, types.EncodingBrotli, types.EncodingGzip}
+				}
+				if compression.MinSize == 0 {
+					compression.MinSize = types.Kilobyte
+				}
+				if len(compression.ContentTypes) == 0 {
+					compression.ContentTypes = types.DefaultCompressionContentTypes
+				}
+			}
+		}
+	}
+	for i := range config.TCPServices {
+		if config.TCPServices[i].Balance == "" {
+			config.TCPServices[i].Balance = types.BalanceRoundRobin
+		}
+		if config.TCPServices[i].ConnectTimeout == 0 {
+			config.TCPServices[i].ConnectTimeout = types.Duration(10 * time.Second)
+		}
+		if breaker := &config.TCPServices[i].CircuitBreaker; breaker.Enabled {
+			applyCircuitBreakerDefaults(breaker)
+		}
+		if proxyProtocol := &config.TCPServices[i].ProxyProtocol; proxyProtocol.Enabled && proxyProtocol.HeaderTimeout == 0 {
+			proxyProtocol.HeaderTimeout = types.Duration(5 * time.Second)
+		}
+	}
+	for i := range config.UDPServices {
+		if config.UDPServices[i].Balance == "" {
+			config.UDPServices[i].Balance = types.BalanceRoundRobin
+		}
+		if config.UDPServices[i].IdleTimeout == 0 {
+			config.UDPServices[i].IdleTimeout = types.Duration(30 * time.Second)
+		}
+	}
+	if config.Server.Timeouts.ReadHeader == 0 {
+		config.Server.Timeouts.ReadHeader = types.Duration(10 * time.Second)
+	}
+	if config.Server.Timeouts.Idle == 0 {
+		config.Server.Timeouts.Idle = types.Duration(2 * time.Minute)
+	}
+	if config.Server.Health.LivenessPath == "" {
+		config.Server.Health.LivenessPath = "/livez"
+	}
+	if config.Server.Health.ReadinessPath == "" {
+		config.Server.Health.ReadinessPath = "/readyz"
+	}
+	if config.Server.Cache.MaxSize == 0 {
+		config.Server.Cache.MaxSize = 64 * types.Megabyte
+	}
+	if config.Server.Cache.MaxEntrySize == 0 {
+		config.Server.Cache.MaxEntrySize = types.Megabyte
+	}
+	if config.Server.Shutdown.DrainTimeout == 0 {
+		config.Server.Shutdown.DrainTimeout = types.Duration(30 * time.Second)
+	}
+	if config.Reload.Debounce == 0 {
+		config.Reload.Debounce = types.Duration(250 * time.Millisecond)
+	}
+}
+
+// applyCircuitBreakerDefaults sets the defaults of an enabled circuit breaker
+func applyCircuitBreakerDefaults(breaker *types.CircuitBreakerConfig) {
+	if breaker.FailureThreshold == 0 {
+		breaker.FailureThreshold = 5
+	}
+	if breaker.Cooldown == 0 {
+		breaker.Cooldown = types.Duration(30 * time.Second)
+	}
+}
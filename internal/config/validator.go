@@ -3,18 +3,60 @@ package config
 import (
 	"AegisGate/pkg/types"
 	"fmt"
+	"net"
+	"net/netip"
 	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
 )
 
-// validateConfig performs basic validation of the configuration
+// ValidationError holds every problem found in a configuration
+type ValidationError struct {
+	Errors []string
+}
+
+// Error returns all problems joined into a single message
+func (e *ValidationError) Error() string {
+	return strings.Join(e.Errors, "; ")
+}
+
+// validateConfig performs basic validation of the configuration and reports
+// every problem found rather than only the first one
 func validateConfig(config *types.Config) error {
+	validationErr := &ValidationError{}
+
 	if err := validateServer(config.Server); err != nil {
-		return fmt.Errorf("server validation failed: %w", err)
+		validationErr.Errors = append(validationErr.Errors, fmt.Sprintf("server validation failed: %v", err))
+	}
+
+	if err := validateAdmin(config.Admin); err != nil {
+		validationErr.Errors = append(validationErr.Errors, fmt.Sprintf("admin validation failed: %v", err))
+	}
+
+	if config.Reload.Debounce < 0 {
+		validationErr.Errors = append(validationErr.Errors, "reload validation failed: debounce cannot be negative")
+	}
+
+	for _, err := range validateListeners(config.Server.Listeners, config.Services) {
+		validationErr.Errors = append(validationErr.Errors, fmt.Sprintf("listeners validation failed: %v", err))
+	}
+
+	// Gateways proxying only TCP or UDP services need no HTTP services
+	if len(config.Services) > 0 || (len(config.TCPServices) == 0 && len(config.UDPServices) == 0) {
+		for _, err := range validateServices(config.Services, reservedPaths(config.Server)) {
+			validationErr.Errors = append(validationErr.Errors, fmt.Sprintf("services validation failed: %v", err))
+		}
+	}
+
+	for _, err := range validateL4Services(config) {
+		validationErr.Errors = append(validationErr.Errors, fmt.Sprintf("l4 services validation failed: %v", err))
 	}
 
-	if err := validateServices(config.Services); err != nil {
-		return fmt.Errorf("services validation failed: %w", err)
+	if len(validationErr.Errors) > 0 {
+		return validationErr
 	}
 
 	return nil
@@ -22,51 +64,584 @@ func validateConfig(config *types.Config) error {
 
 // validateServer validates server-specific configuration
 func validateServer(server types.ServerConfig) error {
-	if server.Port <= 0 || server.Port > 65535 {
-		return fmt.Errorf("invalid port number: %d (must be between 1 and 65535)", server.Port)
+	// Host and port are only used when no listeners are configured
+	if len(server.Listeners) == 0 {
+		if server.Port <= 0 || server.Port > 65535 {
+			return fmt.Errorf("invalid port number: %d (must be between 1 and 65535)", server.Port)
+		}
+
+		if server.Host == "" {
+			return fmt.Errorf("host cannot be empty")
+		}
+	}
+
+	timeouts := server.Timeouts
+	if timeouts.ReadHeader < 0 || timeouts.Read < 0 || timeouts.Write < 0 || timeouts.Idle < 0 {
+		return fmt.Errorf("timeouts cannot be negative")
+	}
+
+	if server.MaxHeaderBytes < 0 {
+		return fmt.Errorf("max_header_bytes cannot be negative")
+	}
+
+	if server.MaxHeaderCount < 0 || server.MaxHeaderSize < 0 {
+		return fmt.Errorf("header limits cannot be negative")
+	}
+
+	if server.MaxBodySize < 0 {
+		return fmt.Errorf("max_body_size cannot be negative")
+	}
+
+	if server.Connections.Max < 0 || server.Connections.MaxPerIP < 0 {
+		return fmt.Errorf("connection limits cannot be negative")
+	}
+
+	if err := validateDebugDump(server.DebugDump); err != nil {
+		return err
+	}
+
+	if server.Cache.MaxSize < 0 || server.Cache.MaxEntrySize < 0 {
+		return fmt.Errorf("cache sizes cannot be negative")
+	}
+
+	if server.Cache.MaxEntrySize > server.Cache.MaxSize {
+		return fmt.Errorf("cache.max_entry_size cannot exceed cache.max_size")
+	}
+
+	if err := validateHealth(server.Health); err != nil {
+		return err
+	}
+
+	if server.Shutdown.PreStopDelay < 0 {
+		return fmt.Errorf("shutdown.pre_stop_delay cannot be negative")
+	}
+
+	if server.Shutdown.DrainTimeout < 0 {
+		return fmt.Errorf("shutdown.drain_timeout cannot be negative")
+	}
+
+	return nil
+}
+
+// validateDebugDump validates the debug dump redaction settings
+func validateDebugDump(dump types.DebugDumpConfig) error {
+	for i, pattern := range dump.RedactPatterns {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("debug_dump.redact_patterns[%d]: invalid pattern '%s': %v", i, pattern, err)
+		}
+	}
+
+	for i, field := range dump.RedactJSONFields {
+		for _, segment := range strings.Split(field, ".") {
+			if segment == "" {
+				return fmt.Errorf("debug_dump.redact_json_fields[%d]: invalid field path '%s'", i, field)
+			}
+		}
+	}
+
+	return nil
+}
+
+// validateHealth validates the paths of the health endpoints
+func validateHealth(health types.HealthConfig) error {
+	if !strings.HasPrefix(health.LivenessPath, "/") {
+		return fmt.Errorf("health.liveness_path must start with '/'")
+	}
+
+	if !strings.HasPrefix(health.ReadinessPath, "/") {
+		return fmt.Errorf("health.readiness_path must start with '/'")
+	}
+
+	if health.LivenessPath == health.ReadinessPath {
+		return fmt.Errorf("health.liveness_path and health.readiness_path must differ")
+	}
+
+	return nil
+}
+
+// reservedPaths returns the paths served by the gateway itself
+func reservedPaths(server types.ServerConfig) map[string]bool {
+	return map[string]bool{
+		server.Health.LivenessPath:  true,
+		server.Health.ReadinessPath: true,
+		types.LegacyHealthPath:      true,
+	}
+}
+
+// validateListeners validates the listeners configuration, returning the
+// first problem found in each listener
+func validateListeners(listeners []types.ListenerConfig, services []types.ServiceConfig) []error {
+	serviceNames := make(map[string]bool, len(services))
+	for _, service := range services {
+		serviceNames[service.Name] = true
+	}
+
+	var errs []error
+	listenerNames := make(map[string]bool)
+	addresses := make(map[string]bool)
+	udpAddresses := make(map[string]bool)
+
+	for i, listener := range listeners {
+		if err := validateListener(listener, i, serviceNames); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		if listenerNames[listener.Name] {
+			errs = append(errs, fmt.Errorf("listener[%d]: duplicate listener name '%s'", i, listener.Name))
+			continue
+		}
+		listenerNames[listener.Name] = true
+
+		if addresses[listener.Address] {
+			errs = append(errs, fmt.Errorf("listener[%d]: duplicate address '%s'", i, listener.Address))
+			continue
+		}
+		addresses[listener.Address] = true
+
+		if listener.HTTP3.Enabled {
+			if udpAddresses[listener.HTTP3.Address] {
+				errs = append(errs, fmt.Errorf("listener[%d]: duplicate http3 address '%s'", i, listener.HTTP3.Address))
+				continue
+			}
+			udpAddresses[listener.HTTP3.Address] = true
+		}
+	}
+
+	return errs
+}
+
+// validateListener validates a single listener configuration
+func validateListener(listener types.ListenerConfig, index int, serviceNames map[string]bool) error {
+	if listener.Name == "" {
+		return fmt.Errorf("listener[%d]: name cannot be empty", index)
+	}
+
+	// The admin listener is handed over on upgrade under this name
+	if listener.Name == "admin" {
+		return fmt.Errorf("listener[%d]: name 'admin' is reserved for the admin API", index)
+	}
+
+	if err := validateListenerAddress(listener); err != nil {
+		return fmt.Errorf("listener[%d]: %v", index, err)
+	}
+
+	switch listener.Protocol {
+	case types.ProtocolHTTPS:
+		if listener.TLS.CertFile == "" || listener.TLS.KeyFile == "" {
+			return fmt.Errorf("listener[%d]: https requires tls.cert_file and tls.key_file", index)
+		}
+		switch listener.TLS.MinVersion {
+		case "", "1.2", "1.3":
+		default:
+			return fmt.Errorf("listener[%d]: invalid tls.min_version '%s' (must be 1.2 or 1.3)", index, listener.TLS.MinVersion)
+		}
+	case types.ProtocolHTTP, types.ProtocolH2C:
+		if listener.TLS != (types.TLSConfig{}) {
+			return fmt.Errorf("listener[%d]: tls settings require the https protocol", index)
+		}
+	default:
+		return fmt.Errorf("listener[%d]: invalid protocol '%s' (must be http, https or h2c)", index, listener.Protocol)
+	}
+
+	timeouts := listener.Timeouts
+	if timeouts.ReadHeader < 0 || timeouts.Read < 0 || timeouts.Write < 0 || timeouts.Idle < 0 {
+		return fmt.Errorf("listener[%d]: timeouts cannot be negative", index)
+	}
+
+	if listener.MaxHeaderBytes < 0 {
+		return fmt.Errorf("listener[%d]: max_header_bytes cannot be negative", index)
+	}
+
+	if err := validateHTTP3(listener); err != nil {
+		return fmt.Errorf("listener[%d]: %v", index, err)
+	}
+
+	if err := validateProxyProtocol(listener.ProxyProtocol); err != nil {
+		return fmt.Errorf("listener[%d]: %v", index, err)
+	}
+
+	for _, service := range listener.Services {
+		if !serviceNames[service] {
+			return fmt.Errorf("listener[%d]: unknown service '%s'", index, service)
+		}
+	}
+
+	return nil
+}
+
+// validateListenAddress validates the host and port a listener binds
+func validateListenAddress(address string) error {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return fmt.Errorf("invalid address '%s': %v", address, err)
+	}
+	if portNumber, err := strconv.Atoi(port); err != nil || portNumber <= 0 || portNumber > 65535 {
+		return fmt.Errorf("invalid port number: %s (must be between 1 and 65535)", port)
+	}
+	if host == "" {
+		return fmt.Errorf("address must include a host")
+	}
+	return nil
+}
+
+// validateListenerAddress validates the TCP address or Unix socket of a
+// listener. Client addresses and QUIC require a TCP or UDP address.
+func validateListenerAddress(listener types.ListenerConfig) error {
+	path, unix := types.UnixSocketPath(listener.Address)
+	if !unix {
+		if listener.Socket != (types.UnixSocketConfig{}) {
+			return fmt.Errorf("socket settings require a unix:// address")
+		}
+		return validateListenAddress(listener.Address)
+	}
+
+	if !strings.HasPrefix(path, "/") {
+		return fmt.Errorf("invalid address '%s': socket path must be absolute", listener.Address)
+	}
+
+	if mode := listener.Socket.Mode; mode != "" {
+		if value, err := strconv.ParseUint(mode, 8, 32); err != nil || value > 0o777 {
+			return fmt.Errorf("invalid socket.mode '%s' (must be octal permissions such as 0660)", mode)
+		}
+	}
+
+	if listener.HTTP3.Enabled {
+		return fmt.Errorf("http3 cannot be used on a unix socket")
+	}
+	if listener.ProxyProtocol.Enabled {
+		return fmt.Errorf("proxy_protocol cannot be used on a unix socket")
+	}
+
+	return nil
+}
+
+// validateHTTP3 validates the HTTP/3 settings of a listener
+func validateHTTP3(listener types.ListenerConfig) error {
+	http3 := listener.HTTP3
+	if !http3.Enabled {
+		if http3 != (types.HTTP3Config{}) {
+			return fmt.Errorf("http3 settings require http3.enabled")
+		}
+		return nil
+	}
+
+	if listener.Protocol != types.ProtocolHTTPS {
+		return fmt.Errorf("http3 requires the https protocol")
 	}
 
-	if server.Host == "" {
-		return fmt.Errorf("host cannot be empty")
+	if err := validateListenAddress(http3.Address); err != nil {
+		return fmt.Errorf("http3: %v", err)
+	}
+
+	if http3.AltSvcMaxAge < 0 {
+		return fmt.Errorf("http3.alt_svc_max_age cannot be negative")
 	}
 
 	return nil
 }
 
-// validateServices validates the services configuration
-func validateServices(services []types.ServiceConfig) error {
+// validateL4Services validates the TCP and UDP services. Their names must
+// differ from every other service, and their addresses from every listener
+// on the same network.
+func validateL4Services(config *types.Config) []error {
+	names := make(map[string]bool, len(config.Services))
+	for _, service := range config.Services {
+		names[service.Name] = true
+	}
+
+	tcpAddresses := make(map[string]bool)
+	udpAddresses := make(map[string]bool)
+	for _, listener := range config.Server.GetListeners() {
+		tcpAddresses[listener.Address] = true
+		if listener.HTTP3.Enabled {
+			udpAddresses[listener.HTTP3.Address] = true
+		}
+	}
+
+	var errs []error
+	for i, service := range config.TCPServices {
+		if err := validateTCPService(service, i); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		if names[service.Name] {
+			errs = append(errs, fmt.Errorf("tcp_service[%d]: duplicate service name '%s'", i, service.Name))
+			continue
+		}
+		names[service.Name] = true
+
+		if tcpAddresses[service.Listen] {
+			errs = append(errs, fmt.Errorf("tcp_service[%d]: duplicate address '%s'", i, service.Listen))
+			continue
+		}
+		tcpAddresses[service.Listen] = true
+	}
+
+	for i, service := range config.UDPServices {
+		if err := validateUDPService(service, i); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		if names[service.Name] {
+			errs = append(errs, fmt.Errorf("udp_service[%d]: duplicate service name '%s'", i, service.Name))
+			continue
+		}
+		names[service.Name] = true
+
+		if udpAddresses[service.Listen] {
+			errs = append(errs, fmt.Errorf("udp_service[%d]: duplicate address '%s'", i, service.Listen))
+			continue
+		}
+		udpAddresses[service.Listen] = true
+	}
+
+	return errs
+}
+
+// validateTCPService validates a single TCP service
+func validateTCPService(service types.TCPServiceConfig, index int) error {
+	if service.Name == "" {
+		return fmt.Errorf("tcp_service[%d]: name cannot be empty", index)
+	}
+
+	if err := validateListenAddress(service.Listen); err != nil {
+		return fmt.Errorf("tcp_service[%d]: %v", index, err)
+	}
+
+	// Connections are routed by server name alone when no default targets are set
+	if len(service.Targets) == 0 && len(service.SNI) == 0 {
+		return fmt.Errorf("tcp_service[%d]: at least one target or sni route must be configured", index)
+	}
+	if err := validateL4Targets(service.Targets); err != nil {
+		return fmt.Errorf("tcp_service[%d]: %v", index, err)
+	}
+
+	if err := validateBalance(service.Balance); err != nil {
+		return fmt.Errorf("tcp_service[%d]: %v", index, err)
+	}
+
+	if service.MaxConnections < 0 {
+		return fmt.Errorf("tcp_service[%d]: max_connections cannot be negative", index)
+	}
+
+	if service.ConnectTimeout < 0 || service.IdleTimeout < 0 {
+		return fmt.Errorf("tcp_service[%d]: timeouts cannot be negative", index)
+	}
+
+	if err := validateCircuitBreaker(service.CircuitBreaker); err != nil {
+		return fmt.Errorf("tcp_service[%d]: %v", index, err)
+	}
+	if len(service.CircuitBreaker.FailureStatuses) > 0 {
+		return fmt.Errorf("tcp_service[%d]: circuit_breaker.failure_statuses only apply to HTTP services", index)
+	}
+
+	if err := validateProxyProtocol(service.ProxyProtocol); err != nil {
+		return fmt.Errorf("tcp_service[%d]: %v", index, err)
+	}
+
+	if service.SendProxyProtocol != "" {
+		if err := validateProxyProtocolVersion(service.SendProxyProtocol); err != nil {
+			return fmt.Errorf("tcp_service[%d]: %v", index, err)
+		}
+	}
+
+	serverNames := make(map[string]bool)
+	for j, route := range service.SNI {
+		if len(route.ServerNames) == 0 {
+			return fmt.Errorf("tcp_service[%d].sni[%d]: server_names cannot be empty", index, j)
+		}
+		for _, name := range route.ServerNames {
+			if err := validateServerName(name); err != nil {
+				return fmt.Errorf("tcp_service[%d].sni[%d]: %v", index, j, err)
+			}
+			if serverNames[strings.ToLower(name)] {
+				return fmt.Errorf("tcp_service[%d].sni[%d]: duplicate server name '%s'", index, j, name)
+			}
+			serverNames[strings.ToLower(name)] = true
+		}
+
+		if len(route.Targets) == 0 {
+			return fmt.Errorf("tcp_service[%d].sni[%d]: at least one target must be configured", index, j)
+		}
+		if err := validateL4Targets(route.Targets); err != nil {
+			return fmt.Errorf("tcp_service[%d].sni[%d]: %v", index, j, err)
+		}
+	}
+
+	return nil
+}
+
+// validateUDPService validates a single UDP service
+func validateUDPService(service types.UDPServiceConfig, index int) error {
+	if service.Name == "" {
+		return fmt.Errorf("udp_service[%d]: name cannot be empty", index)
+	}
+
+	if err := validateListenAddress(service.Listen); err != nil {
+		return fmt.Errorf("udp_service[%d]: %v", index, err)
+	}
+
+	if len(service.Targets) == 0 {
+		return fmt.Errorf("udp_service[%d]: at least one target must be configured", index)
+	}
+	if err := validateL4Targets(service.Targets); err != nil {
+		return fmt.Errorf("udp_service[%d]: %v", index, err)
+	}
+
+	if err := validateBalance(service.Balance); err != nil {
+		return fmt.Errorf("udp_service[%d]: %v", index, err)
+	}
+
+	if service.MaxSessions < 0 {
+		return fmt.Errorf("udp_service[%d]: max_sessions cannot be negative", index)
+	}
+
+	if service.IdleTimeout < 0 {
+		return fmt.Errorf("udp_service[%d]: idle_timeout cannot be negative", index)
+	}
+
+	return nil
+}
+
+// validateL4Targets validates the host and port of TCP and UDP targets
+func validateL4Targets(targets []string) error {
+	seen := make(map[string]bool, len(targets))
+	for _, target := range targets {
+		host, port, err := net.SplitHostPort(target)
+		if err != nil {
+			return fmt.Errorf("invalid target '%s': %v", target, err)
+		}
+		if host == "" {
+			return fmt.Errorf("target '%s' must include a host", target)
+		}
+		if portNumber, err := strconv.Atoi(port); err != nil || portNumber <= 0 || portNumber > 65535 {
+			return fmt.Errorf("invalid port number in target '%s' (must be between 1 and 65535)", target)
+		}
+		if seen[target] {
+			return fmt.Errorf("duplicate target '%s'", target)
+		}
+		seen[target] = true
+	}
+	return nil
+}
+
+// validateBalance validates the load balancing strategy of a TCP or UDP service
+func validateBalance(balance string) error {
+	switch balance {
+	case types.BalanceRoundRobin, types.BalanceLeastConnections:
+		return nil
+	default:
+		return fmt.Errorf("invalid balance '%s' (must be round_robin or least_connections)", balance)
+	}
+}
+
+// validateServerName validates a server name of an SNI route, which may start
+// with a "*." wildcard label
+func validateServerName(name string) error {
+	host := strings.TrimPrefix(name, "*.")
+	if host == "" || strings.Contains(host, "*") || strings.ContainsAny(host, " /:") {
+		return fmt.Errorf("invalid server name '%s'", name)
+	}
+	return nil
+}
+
+// validateProxyProtocol validates the PROXY protocol settings of a listener
+// or TCP service
+func validateProxyProtocol(config types.ProxyProtocolConfig) error {
+	if !config.Enabled {
+		if len(config.TrustedCIDRs) > 0 || config.HeaderTimeout != 0 {
+			return fmt.Errorf("proxy_protocol settings require proxy_protocol.enabled")
+		}
+		return nil
+	}
+
+	// Accepting headers from anyone would let clients spoof their address
+	if len(config.TrustedCIDRs) == 0 {
+		return fmt.Errorf("proxy_protocol requires trusted_cidrs")
+	}
+	for _, cidr := range config.TrustedCIDRs {
+		if _, err := netip.ParsePrefix(cidr); err != nil {
+			return fmt.Errorf("proxy_protocol: invalid trusted CIDR '%s'", cidr)
+		}
+	}
+
+	if config.HeaderTimeout < 0 {
+		return fmt.Errorf("proxy_protocol.header_timeout cannot be negative")
+	}
+
+	return nil
+}
+
+// validateProxyProtocolVersion validates the version of PROXY protocol headers sent to targets
+func validateProxyProtocolVersion(version string) error {
+	switch version {
+	case types.ProxyProtocolV1, types.ProxyProtocolV2:
+		return nil
+	default:
+		return fmt.Errorf("invalid send_proxy_protocol '%s' (must be v1 or v2)", version)
+	}
+}
+
+// validateAdmin validates the admin API configuration
+func validateAdmin(admin types.AdminConfig) error {
+	if !admin.Enabled {
+		return nil
+	}
+
+	if admin.Port <= 0 || admin.Port > 65535 {
+		return fmt.Errorf("invalid port number: %d (must be between 1 and 65535)", admin.Port)
+	}
+
+	auth := admin.Auth
+	if auth.Token == "" && (auth.Username == "" || auth.Password == "") {
+		return fmt.Errorf("auth requires a token or a username and password")
+	}
+
+	if auth.Token != "" && auth.Username != "" {
+		return fmt.Errorf("auth must use either a token or a username and password, not both")
+	}
+
+	return nil
+}
+
+// validateServices validates the services configuration, returning the
+// first problem found in each service
+func validateServices(services []types.ServiceConfig, reservedPaths map[string]bool) []error {
 	if len(services) == 0 {
-		return fmt.Errorf("at least one service must be configured")
+		return []error{fmt.Errorf("at least one service must be configured")}
 	}
 
+	var errs []error
 	serviceNames := make(map[string]bool)
 	servicePaths := make(map[string]bool)
 
 	for i, service := range services {
-		if err := validateService(service, i); err != nil {
-			return err
+		if err := validateService(service, i, reservedPaths); err != nil {
+			errs = append(errs, err)
+			continue
 		}
 
 		if serviceNames[service.Name] {
-			return fmt.Errorf("service[%d]: duplicate service name '%s'", i, service.Name)
+			errs = append(errs, fmt.Errorf("service[%d]: duplicate service name '%s'", i, service.Name))
+			continue
 		}
 		serviceNames[service.Name] = true
 
 		if servicePaths[service.BasePath] {
-			return fmt.Errorf("service[%d]: duplicate base path '%s'", i, service.BasePath)
+			errs = append(errs, fmt.Errorf("service[%d]: duplicate base path '%s'", i, service.BasePath))
+			continue
 		}
 		servicePaths[service.BasePath] = true
 	}
 
-	return nil
+	return errs
 }
 
 // validateService validates a single service configuration
-func validateService(service types.ServiceConfig, index int) error {
-	reservedPaths := map[string]bool{
-		"/health": true,
-	}
-
+func validateService(service types.ServiceConfig, index int, reservedPaths map[string]bool) error {
 	if service.Name == "" {
 		return fmt.Errorf("service[%d]: name cannot be empty", index)
 	}
@@ -87,14 +662,134 @@ func validateService(service types.ServiceConfig, index int) error {
 		return fmt.Errorf("service[%d]: target URL cannot be empty", index)
 	}
 
-	if _, err := url.Parse(service.TargetURL); err != nil {
+	targetURL, err := url.Parse(service.TargetURL)
+	if err != nil {
 		return fmt.Errorf("service[%d]: invalid target URL '%s': %v", index, service.TargetURL, err)
 	}
 
-	if err := validateRoutes(service.Routes, index); err != nil {
+	if targetURL.Scheme == types.UnixScheme {
+		if targetURL.Host != "" || !strings.HasPrefix(targetURL.Path, "/") {
+			return fmt.Errorf("service[%d]: invalid target URL '%s' (must be unix:// followed by an absolute socket path)", index, service.TargetURL)
+		}
+		dns := service.Transport.DNS
+		if len(dns.Servers) > 0 || dns.RefreshInterval != 0 {
+			return fmt.Errorf("service[%d].transport: dns settings cannot be used with a unix socket target", index)
+		}
+	}
+
+	switch service.Protocol {
+	case types.ServiceProtocolHTTP, types.ServiceProtocolGRPC:
+	default:
+		return fmt.Errorf("service[%d]: invalid protocol '%s' (must be http or grpc)", index, service.Protocol)
+	}
+
+	if err := validateTimeouts(service.Timeout, service.Timeouts); err != nil {
+		return fmt.Errorf("service[%d]: %v", index, err)
+	}
+
+	if err := validateBodyLimits(service.MaxBodySize, service.ContentTypes); err != nil {
+		return fmt.Errorf("service[%d]: %v", index, err)
+	}
+
+	if err := validateCircuitBreaker(service.CircuitBreaker); err != nil {
+		return fmt.Errorf("service[%d]: %v", index, err)
+	}
+
+	// gRPC services always speak HTTP/2, which the transport checks depend on
+	if err := validateTransport(service.GetTransport(), service.TargetURL, index); err != nil {
 		return err
 	}
 
+	if err := validateTranscoding(service, index); err != nil {
+		return err
+	}
+
+	// The routes of a transcoded service may all come from its annotations
+	if len(service.Routes) > 0 || !service.Transcoding.Annotations {
+		if err := validateRoutes(service.Routes, index); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// validateTranscoding validates the gRPC transcoding settings of a service
+func validateTranscoding(service types.ServiceConfig, index int) error {
+	transcoding := service.Transcoding
+	transcoded := transcoding.Annotations || slices.ContainsFunc(service.Routes, func(route types.Route) bool {
+		return route.IsTranscoded()
+	})
+
+	if !transcoded {
+		if transcoding.DescriptorSet != "" || len(transcoding.Services) > 0 || transcoding.SkipConflictingBindings {
+			return fmt.Errorf("service[%d].transcoding: no route is transcoded (set annotations or a route grpc.method)", index)
+		}
+		return nil
+	}
+
+	if service.Protocol != types.ServiceProtocolGRPC {
+		return fmt.Errorf("service[%d]: transcoding requires protocol grpc", index)
+	}
+
+	if transcoding.DescriptorSet == "" {
+		return fmt.Errorf("service[%d].transcoding: descriptor_set cannot be empty", index)
+	}
+
+	if transcoding.SkipConflictingBindings && !transcoding.Annotations {
+		return fmt.Errorf("service[%d].transcoding: skip_conflicting_bindings requires annotations", index)
+	}
+
+	return nil
+}
+
+// validateTransport validates the upstream transport settings of a service
+func validateTransport(transport types.TransportConfig, targetURL string, serviceIndex int) error {
+	if transport.DialTimeout < 0 || transport.TLSHandshakeTimeout < 0 ||
+		transport.ResponseHeaderTimeout < 0 || transport.IdleConnTimeout < 0 {
+		return fmt.Errorf("service[%d].transport: timeouts cannot be negative", serviceIndex)
+	}
+
+	if transport.MaxIdleConns < 0 || transport.MaxIdleConnsPerHost < 0 || transport.MaxConnsPerHost < 0 {
+		return fmt.Errorf("service[%d].transport: connection limits cannot be negative", serviceIndex)
+	}
+
+	if transport.DNS.RefreshInterval < 0 {
+		return fmt.Errorf("service[%d].transport: dns.refresh_interval cannot be negative", serviceIndex)
+	}
+
+	if transport.HTTP2 && transport.DisableHTTP2 {
+		return fmt.Errorf("service[%d].transport: disable_http2 cannot be used with http2 or the grpc protocol", serviceIndex)
+	}
+
+	// h2c connections are managed by the HTTP/2 transport, which lacks these settings
+	if target, err := url.Parse(targetURL); err == nil && transport.HTTP2 && target.Scheme != "https" {
+		if transport.TLSHandshakeTimeout != 0 || transport.ResponseHeaderTimeout != 0 ||
+			transport.MaxIdleConns != 0 || transport.MaxIdleConnsPerHost != 0 || transport.MaxConnsPerHost != 0 {
+			return fmt.Errorf("service[%d].transport: tls_handshake_timeout, response_header_timeout and connection limits cannot be used with h2c targets, use the timeouts of the routes instead", serviceIndex)
+		}
+	}
+
+	for i, server := range transport.DNS.Servers {
+		host := server
+		if h, _, err := net.SplitHostPort(server); err == nil {
+			host = h
+		}
+		if net.ParseIP(host) == nil {
+			return fmt.Errorf("service[%d].transport: dns.servers[%d]: '%s' is not an IP address", serviceIndex, i, server)
+		}
+	}
+
+	if transport.SendProxyProtocol != "" {
+		if err := validateProxyProtocolVersion(transport.SendProxyProtocol); err != nil {
+			return fmt.Errorf("service[%d].transport: %v", serviceIndex, err)
+		}
+		// HTTP/2 multiplexes the requests of many clients on one connection
+		if transport.HTTP2 {
+			return fmt.Errorf("service[%d].transport: send_proxy_protocol cannot be used with http2 or the grpc protocol", serviceIndex)
+		}
+	}
+
 	return nil
 }
 
@@ -141,20 +836,244 @@ func validateRoute(route types.Route, serviceIndex, routeIndex int) error {
 		}
 	}
 
-	// Validate timeout format if specified
-	if route.Timeout != 0 {
-		if err := validateTimeout(route.Timeout, serviceIndex, routeIndex); err != nil {
-			return err
+	if err := validateTimeouts(route.Timeout, route.Timeouts); err != nil {
+		return fmt.Errorf("service[%d].route[%d]: %v", serviceIndex, routeIndex, err)
+	}
+
+	if err := validateBodyLimits(route.MaxBodySize, route.ContentTypes); err != nil {
+		return fmt.Errorf("service[%d].route[%d]: %v", serviceIndex, routeIndex, err)
+	}
+
+	if err := validateWebSocket(route); err != nil {
+		return fmt.Errorf("service[%d].route[%d]: %v", serviceIndex, routeIndex, err)
+	}
+
+	if err := validateGRPCMapping(route); err != nil {
+		return fmt.Errorf("service[%d].route[%d]: %v", serviceIndex, routeIndex, err)
+	}
+
+	if err := validateRouteCache(route); err != nil {
+		return fmt.Errorf("service[%d].route[%d]: %v", serviceIndex, routeIndex, err)
+	}
+
+	if err := validateCompression(route.Compression); err != nil {
+		return fmt.Errorf("service[%d].route[%d]: %v", serviceIndex, routeIndex, err)
+	}
+
+	if err := validateRequestValidation(route); err != nil {
+		return fmt.Errorf("service[%d].route[%d]: %v", serviceIndex, routeIndex, err)
+	}
+
+	return nil
+}
+
+// validateGRPCMapping validates the gRPC method a route is transcoded to
+func validateGRPCMapping(route types.Route) error {
+	mapping := route.GRPC
+	if !route.IsTranscoded() {
+		if mapping.Body != "" || mapping.ResponseBody != "" {
+			return fmt.Errorf("grpc.body and grpc.response_body require grpc.method")
+		}
+		return nil
+	}
+
+	service, method, found := strings.Cut(mapping.Method, "/")
+	if !found || service == "" || method == "" || strings.Contains(method, "/") {
+		return fmt.Errorf("invalid grpc.method '%s' (must be package.Service/Method)", mapping.Method)
+	}
+
+	if route.WebSocket.Enabled {
+		return fmt.Errorf("websocket cannot be enabled on a transcoded route")
+	}
+
+	return nil
+}
+
+// validateWebSocket validates the WebSocket settings of a route
+func validateWebSocket(route types.Route) error {
+	websocket := route.WebSocket
+	if !websocket.Enabled {
+		return nil
+	}
+
+	if websocket.IdleTimeout < 0 || websocket.MaxLifetime < 0 {
+		return fmt.Errorf("websocket timeouts cannot be negative")
+	}
+
+	if websocket.MaxConnections < 0 {
+		return fmt.Errorf("websocket.max_connections cannot be negative")
+	}
+
+	if !slices.Contains(route.GetMethods(), types.GET) {
+		return fmt.Errorf("websocket requires the GET method")
+	}
+
+	return nil
+}
+
+// validateRouteCache validates the response cache settings of a route
+func validateRouteCache(route types.Route) error {
+	cache := route.Cache
+	if !cache.Enabled {
+		if cache.TTL != 0 || cache.StaleWhileRevalidate != 0 || cache.StaleIfError != 0 ||
+			len(cache.Key.Headers) > 0 || len(cache.Key.Query) > 0 || cache.Key.Consumer {
+			return fmt.Errorf("cache settings require cache.enabled")
+		}
+		return nil
+	}
+
+	if cache.TTL < 0 || cache.StaleWhileRevalidate < 0 || cache.StaleIfError < 0 {
+		return fmt.Errorf("cache durations cannot be negative")
+	}
+
+	if !slices.Contains(route.GetMethods(), types.GET) {
+		return fmt.Errorf("cache requires the GET method")
+	}
+
+	for i, header := range cache.Key.Headers {
+		if header == "" || strings.ContainsAny(header, " \t:") {
+			return fmt.Errorf("cache.key.headers[%d]: invalid header name '%s'", i, header)
+		}
+	}
+
+	for i, param := range cache.Key.Query {
+		if param == "" {
+			return fmt.Errorf("cache.key.query[%d]: parameter name cannot be empty", i)
+		}
+	}
+
+	return nil
+}
+
+// validateCompression validates the compression settings of a route. Request
+// bodies can be decompressed without compressing responses.
+func validateCompression(compression types.CompressionConfig) error {
+	if !compression.Enabled {
+		if len(compression.Algorithms) > 0 || compression.MinSize != 0 || len(compression.ContentTypes) > 0 || compression.Level != 0 {
+			return fmt.Errorf("compression settings require compression.enabled")
+		}
+		return nil
+	}
+
+	seen := make(map[string]bool)
+	for i, algorithm := range compression.Algorithms {
+		switch algorithm {
+		case types.EncodingGzip, types.EncodingBrotli, types.EncodingZstd:
+		default:
+			return fmt.Errorf("compression.algorithms[%d]: unknown algorithm '%s' (must be zstd, br or gzip)", i, algorithm)
+		}
+		if seen[algorithm] {
+			return fmt.Errorf("compression.algorithms[%d]: duplicate algorithm '%s'", i, algorithm)
 		}
+		seen[algorithm] = true
+	}
+
+	if compression.MinSize < 0 {
+		return fmt.Errorf("compression.min_size cannot be negative")
+	}
+
+	if compression.Level < 0 || compression.Level > 9 {
+		return fmt.Errorf("invalid compression.level %d (must be between 1 and 9, or 0 for the default)", compression.Level)
+	}
+
+	for i, contentType := range compression.ContentTypes {
+		if strings.TrimSpace(contentType) == "" {
+			return fmt.Errorf("compression.content_types[%d]: content type cannot be empty", i)
+		}
+	}
+
+	return nil
+}
+
+// validateRequestValidation validates the JSON Schemas requests of a route
+// must match. The schemas are compiled when the routes are set up.
+func validateRequestValidation(route types.Route) error {
+	validation := route.Validation
+	if !validation.Enabled() {
+		return nil
+	}
+
+	if route.WebSocket.Enabled {
+		return fmt.Errorf("validation cannot be used on a websocket route")
+	}
+
+	if validation.BodySchema != "" && !slices.ContainsFunc(route.GetMethods(), func(method types.HTTPMethod) bool {
+		return method == types.POST || method == types.PUT || method == types.PATCH || method == types.DELETE
+	}) {
+		return fmt.Errorf("validation.body_schema requires a POST, PUT, PATCH or DELETE method")
+	}
+
+	if err := validateSchemaFile("body_schema", validation.BodySchema); err != nil {
+		return err
+	}
+	if err := validateSchemaFile("query_schema", validation.QuerySchema); err != nil {
+		return err
 	}
 
 	return nil
 }
 
-// validateTimeout validates the timeout format
-func validateTimeout(timeout uint, serviceIndex, routeIndex int) error {
-	if timeout <= 0 {
-		return fmt.Errorf("service[%d].route[%d]: timeout must be greater than 0", serviceIndex, routeIndex)
+// validateSchemaFile checks that a configured JSON Schema file exists
+func validateSchemaFile(name, file string) error {
+	if file == "" {
+		return nil
+	}
+	if _, err := os.Stat(file); err != nil {
+		return fmt.Errorf("validation.%s: %v", name, err)
+	}
+	return nil
+}
+
+// validateCircuitBreaker validates the circuit breaker settings of a service
+func validateCircuitBreaker(breaker types.CircuitBreakerConfig) error {
+	if !breaker.Enabled {
+		if breaker.FailureThreshold != 0 || breaker.Cooldown != 0 || len(breaker.FailureStatuses) > 0 {
+			return fmt.Errorf("circuit_breaker settings require circuit_breaker.enabled")
+		}
+		return nil
+	}
+
+	if breaker.FailureThreshold < 0 {
+		return fmt.Errorf("circuit_breaker.failure_threshold cannot be negative")
+	}
+
+	if breaker.Cooldown < 0 {
+		return fmt.Errorf("circuit_breaker.cooldown cannot be negative")
+	}
+
+	for i, status := range breaker.FailureStatuses {
+		if status < 400 || status > 599 {
+			return fmt.Errorf("circuit_breaker.failure_statuses[%d]: invalid status %d (must be between 400 and 599)", i, status)
+		}
+	}
+
+	return nil
+}
+
+// validateBodyLimits validates the request body limits of a service or route
+func validateBodyLimits(maxBodySize types.ByteSize, contentTypes []string) error {
+	if maxBodySize < 0 {
+		return fmt.Errorf("max_body_size cannot be negative")
+	}
+
+	for i, contentType := range contentTypes {
+		mainType, subType, found := strings.Cut(contentType, "/")
+		if !found || mainType == "" || subType == "" || strings.ContainsAny(contentType, " ;,") {
+			return fmt.Errorf("allowed_content_types[%d]: invalid media type '%s' (must be type/subtype or type/*)", i, contentType)
+		}
+	}
+
+	return nil
+}
+
+// validateTimeouts validates the total and upstream timeouts of a service or route
+func validateTimeouts(timeout types.Duration, timeouts types.UpstreamTimeouts) error {
+	if timeout < 0 {
+		return fmt.Errorf("timeout cannot be negative")
+	}
+
+	if timeouts.Connect < 0 || timeouts.FirstByte < 0 || timeouts.IdleStream < 0 {
+		return fmt.Errorf("timeouts cannot be negative")
 	}
 
 	return nil
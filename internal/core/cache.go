@@ -0,0 +1,738 @@
+package core
+
+import (
+	"AegisGate/internal/cache"
+	"AegisGate/internal/logger"
+	"AegisGate/internal/metrics"
+	"AegisGate/pkg/types"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Response cache metrics
+var (
+	cacheRequestsTotal = metrics.NewCounter("aegisgate_cache_requests_total", "Requests to cached routes by cache result.", "service", "result")
+	cachePurgesTotal   = metrics.NewCounter("aegisgate_cache_purges_total", "Cache purge requests by what they select.", "type")
+	cachePurgedTotal   = metrics.NewCounter("aegisgate_cache_purged_total", "Cached responses removed by purges.", "service")
+)
+
+// Purge types, by what a purge selects
+const (
+	purgeKey     = "key"
+	purgePrefix  = "prefix"
+	purgeTag     = "tag"
+	purgeService = "service"
+	purgeURL     = "url" // PURGE requests
+)
+
+// surrogateKeyHeader lists the tags of a response that it can be purged by
+const surrogateKeyHeader = "Surrogate-Key"
+
+// Cache results, sent to the client in the X-Cache header
+const (
+	cacheHit         = "HIT"         // Fresh response from the cache
+	cacheMiss        = "MISS"        // Response from the target
+	cacheStale       = "STALE"       // Stale response from the cache
+	cacheRevalidated = "REVALIDATED" // Response from the cache the target confirmed to be current
+	cacheBypass      = "BYPASS"      // The client asked not to use the cache
+)
+
+// cacheableStatus lists the status codes whose responses may be cached
+var cacheableStatus = map[int]bool{
+	http.StatusOK:                   true,
+	http.StatusNonAuthoritativeInfo: true,
+	http.StatusNoContent:            true,
+	http.StatusMultipleChoices:      true,
+	http.StatusMovedPermanently:     true,
+	http.StatusPermanentRedirect:    true,
+	http.StatusNotFound:             true,
+	http.StatusMethodNotAllowed:     true,
+	http.StatusGone:                 true,
+	http.StatusRequestURITooLong:    true,
+	http.StatusNotImplemented:       true,
+}
+
+// responseCache stores the responses of routes with caching enabled. It
+// lives as long as the gateway, so cached responses survive reloads.
+type responseCache struct {
+	store        *cache.LRU[*cacheItem]
+	maxEntrySize atomic.Int64
+	mu           sync.Mutex
+	flights      map[string]*cacheFlight
+}
+
+// cacheItem is stored under the key of a request. Responses that vary by
+// request headers are stored under a key that includes the values of those
+// headers, and the item under the request key only lists their names.
+type cacheItem struct {
+	service  string
+	host     string
+	uri      string // Path and query of the request
+	vary     []string
+	response *cachedResponse
+}
+
+// cacheFlight lets concurrent requests for the same key wait for a single
+// request to the target
+type cacheFlight struct {
+	done chan struct{}
+}
+
+// cachedResponse is a stored response with its freshness information
+type cachedResponse struct {
+	status               int
+	header               http.Header
+	body                 []byte
+	date                 time.Time     // When the response was received or last revalidated
+	age                  time.Duration // Age the response already had when it was received
+	lifetime             time.Duration // How long the response is fresh
+	staleWhileRevalidate time.Duration
+	staleIfError         time.Duration
+	vary                 []string
+	tags                 []string // Surrogate keys set by the target
+}
+
+// newResponseCache creates an empty response cache
+func newResponseCache(config types.CacheStoreConfig) *responseCache {
+	c := &responseCache{
+		store:   cache.NewLRU[*cacheItem](int64(config.MaxSize)),
+		flights: make(map[string]*cacheFlight),
+	}
+	c.maxEntrySize.Store(int64(config.MaxEntrySize))
+	return c
+}
+
+// SetLimits updates the size limits, evicting responses if the cache shrinks
+func (c *responseCache) SetLimits(config types.CacheStoreConfig) {
+	c.store.SetMaxSize(int64(config.MaxSize))
+	c.maxEntrySize.Store(int64(config.MaxEntrySize))
+}
+
+// serve answers a request to a cached route from the cache when possible
+// and calls forward to get the response from the target otherwise
+func (c *responseCache) serve(w http.ResponseWriter, r *http.Request, service string, config types.RouteCacheConfig, l *logger.Logger, forward http.HandlerFunc) {
+	key := cacheKey(service, r, config.Key)
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		// Successful unsafe requests invalidate the cached response of the URL
+		rw := logger.NewResponseWriter(w)
+		forward(rw, r)
+		if isUnsafeMethod(r.Method) && rw.StatusCode() < http.StatusBadRequest {
+			c.store.Delete(key)
+		}
+		return
+	}
+
+	directives := parseCacheControl(r.Header)
+	if directives.has("no-store") {
+		w.Header().Set("X-Cache", cacheBypass)
+		cacheRequestsTotal.Inc(service, strings.ToLower(cacheBypass))
+		forward(w, r)
+		return
+	}
+
+	// Clients asking for an up to date response get a cached one only after revalidation
+	revalidate := directives.has("no-cache") || directives["max-age"] == "0" ||
+		(len(directives) == 0 && r.Header.Get("Pragma") == "no-cache")
+
+	entry := c.lookup(key, r)
+	if entry != nil && !revalidate {
+		staleness := entry.staleness(time.Now())
+		switch {
+		case staleness < 0:
+			c.respond(w, r, service, entry, cacheHit)
+			return
+		case staleness < entry.staleWhileRevalidate:
+			c.respond(w, r, service, entry, cacheStale)
+			go c.refresh(service, key, r, entry, config, l, forward)
+			return
+		}
+	}
+
+	if entry == nil && directives.has("only-if-cached") {
+		httpError(w, r, "Gateway Timeout", http.StatusGatewayTimeout)
+		return
+	}
+
+	// Only complete responses are stored, so HEAD requests go straight to the target
+	if r.Method == http.MethodHead {
+		w.Header().Set("X-Cache", cacheMiss)
+		cacheRequestsTotal.Inc(service, strings.ToLower(cacheMiss))
+		forward(w, r)
+		return
+	}
+
+	// Concurrent requests for the same response wait for the first one
+	flight, leader := c.join(key)
+	if !leader {
+		select {
+		case <-flight.done:
+		case <-r.Context().Done():
+			return
+		}
+		if shared := c.lookup(key, r); shared != nil && shared != entry && shared.staleness(time.Now()) < 0 {
+			c.respond(w, r, service, shared, cacheHit)
+			return
+		}
+		c.fetch(w, r, service, key, entry, config, l, forward)
+		return
+	}
+	defer c.leave(key, flight)
+
+	c.fetch(w, r, service, key, entry, config, l, forward)
+}
+
+// fetch gets the response from the target and stores it if allowed. A stored
+// entry is revalidated with a conditional request and served again if the
+// target confirms it is current or fails while it may still be used. The
+// response is only recorded when w is nil.
+func (c *responseCache) fetch(w http.ResponseWriter, r *http.Request, service, key string, entry *cachedResponse, config types.RouteCacheConfig, l *logger.Logger, forward http.HandlerFunc) {
+	// The conditions of the client are evaluated against the stored entry instead
+	out := r
+	if entry != nil {
+		out = r.Clone(r.Context())
+		for _, name := range []string{"If-None-Match", "If-Modified-Since", "If-Match", "If-Unmodified-Since", "If-Range"} {
+			out.Header.Del(name)
+		}
+		if etag := entry.header.Get("ETag"); etag != "" {
+			out.Header.Set("If-None-Match", etag)
+		}
+		if lastModified := entry.header.Get("Last-Modified"); lastModified != "" {
+			out.Header.Set("If-Modified-Since", lastModified)
+		}
+	}
+
+	rec := &cacheRecorder{client: w, header: make(http.Header), limit: c.maxEntrySize.Load()}
+	rec.decide = func(status int, header http.Header) (*cachedResponse, bool) {
+		if entry != nil {
+			if status == http.StatusNotModified {
+				return nil, true
+			}
+			if status >= http.StatusInternalServerError && entry.staleness(time.Now()) < entry.staleIfError {
+				return nil, true
+			}
+		}
+		return newCachedResponse(r, status, header, config), false
+	}
+
+	forward(rec, out)
+
+	switch {
+	case rec.held && rec.status == http.StatusNotModified:
+		updated := entry.revalidated(rec.header, config)
+		c.save(service, key, r, updated)
+		if w != nil {
+			c.respond(w, r, service, updated, cacheRevalidated)
+		}
+
+	case rec.held:
+		l.ServiceDebug(service, "Keeping stale response for %s after target responded with %d", r.URL.Path, rec.status)
+		if w != nil {
+			c.respond(w, r, service, entry, cacheStale)
+		}
+
+	default:
+		if rec.entry != nil && !rec.truncated {
+			rec.entry.body = rec.body.Bytes()
+			c.save(service, key, r, rec.entry)
+		}
+		if w != nil {
+			cacheRequestsTotal.Inc(service, strings.ToLower(cacheMiss))
+		}
+	}
+}
+
+// refresh revalidates a stale response in the background while it is being
+// served, unless another request is already doing so
+func (c *responseCache) refresh(service, key string, r *http.Request, entry *cachedResponse, config types.RouteCacheConfig, l *logger.Logger, forward http.HandlerFunc) {
+	flight, leader := c.join(key)
+	if !leader {
+		return
+	}
+	defer c.leave(key, flight)
+
+	// The reverse proxy aborts the handler when the response body fails
+	defer func() {
+		if v := recover(); v != nil && v != http.ErrAbortHandler {
+			panic(v)
+		}
+	}()
+
+	// The revalidation outlives the request that triggered it
+	refresh := r.Clone(context.WithoutCancel(r.Context()))
+	refresh.Method = http.MethodGet
+	refresh.Body = http.NoBody
+	refresh.ContentLength = 0
+
+	c.fetch(nil, refresh, service, key, entry, config, l, forward)
+}
+
+// join registers a request to the target for key. It reports whether the
+// caller makes the request or has to wait for the returned flight instead.
+func (c *responseCache) join(key string) (*cacheFlight, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if flight, exists := c.flights[key]; exists {
+		return flight, false
+	}
+	flight := &cacheFlight{done: make(chan struct{})}
+	c.flights[key] = flight
+	return flight, true
+}
+
+// leave releases the requests waiting for a flight
+func (c *responseCache) leave(key string, flight *cacheFlight) {
+	c.mu.Lock()
+	delete(c.flights, key)
+	c.mu.Unlock()
+	close(flight.done)
+}
+
+// lookup returns the stored response for a request
+func (c *responseCache) lookup(key string, r *http.Request) *cachedResponse {
+	item, exists := c.store.Get(key)
+	if !exists {
+		return nil
+	}
+	if item.response == nil {
+		if item, exists = c.store.Get(variantKey(key, item.vary, r)); !exists || item.response == nil {
+			return nil
+		}
+	}
+	return item.response
+}
+
+// save stores a response for the requests matching r
+func (c *responseCache) save(service, key string, r *http.Request, response *cachedResponse) {
+	size := response.size() + int64(len(key))
+	if size > c.maxEntrySize.Load() {
+		c.store.Delete(key)
+		return
+	}
+
+	item := cacheItem{service: service, host: strings.ToLower(r.Host), uri: r.URL.RequestURI(), response: response}
+	if len(response.vary) == 0 {
+		c.store.Set(key, &item, size)
+		return
+	}
+
+	index := item
+	index.vary, index.response = response.vary, nil
+	c.store.Set(key, &index, int64(len(key)))
+
+	variant := variantKey(key, response.vary, r)
+	c.store.Set(variant, &item, size+int64(len(variant)))
+}
+
+// purge removes the cached responses for which match returns true, and
+// returns how many were removed
+func (c *responseCache) purge(purgeType string, match func(item *cacheItem) bool) int {
+	cachePurgesTotal.Inc(purgeType)
+
+	purged := 0
+	c.store.DeleteFunc(func(_ string, item *cacheItem) bool {
+		if !match(item) {
+			return false
+		}
+		if item.response != nil {
+			cachePurgedTotal.Inc(item.service)
+			purged++
+		}
+		return true
+	})
+	return purged
+}
+
+// matchesKey reports whether the item was stored for a request to the host
+// and path with query in key, or only to the path if key starts with a slash
+func (item *cacheItem) matchesKey(key string, prefix bool) bool {
+	url := item.host + item.uri
+	if strings.HasPrefix(key, "/") {
+		url = item.uri
+	}
+	if prefix {
+		return strings.HasPrefix(url, key)
+	}
+	return url == key
+}
+
+// respond writes a stored response, or 304 Not Modified if it matches the
+// conditions of the request
+func (c *responseCache) respond(w http.ResponseWriter, r *http.Request, service string, response *cachedResponse, result string) {
+	cacheRequestsTotal.Inc(service, strings.ToLower(result))
+
+	h := w.Header()
+	for name, values := range response.header {
+		h[name] = slices.Clone(values)
+	}
+	h.Set("Age", strconv.FormatInt(int64(response.currentAge(time.Now())/time.Second), 10))
+	h.Set("X-Cache", result)
+
+	if response.status == http.StatusOK && notModified(r, response.header) {
+		h.Del("Content-Length")
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.WriteHeader(response.status)
+	if r.Method != http.MethodHead {
+		_, _ = w.Write(response.body)
+	}
+}
+
+// newCachedResponse returns the response to store for a request, or nil if
+// the response may not be cached
+func newCachedResponse(r *http.Request, status int, header http.Header, config types.RouteCacheConfig) *cachedResponse {
+	if r.Method != http.MethodGet || !cacheableStatus[status] {
+		return nil
+	}
+
+	directives := parseCacheControl(header)
+	if directives.has("no-store") || header.Get("Set-Cookie") != "" || header.Get("Trailer") != "" {
+		return nil
+	}
+
+	// Responses meant for a single client are only shared between its own requests
+	if !config.Key.Consumer {
+		if directives.has("private") {
+			return nil
+		}
+		if r.Header.Get("Authorization") != "" && !directives.has("public") && !directives.has("s-maxage") && !directives.has("must-revalidate") {
+			return nil
+		}
+	}
+
+	vary := varyHeaders(header)
+	if slices.Contains(vary, "*") {
+		return nil
+	}
+
+	response := &cachedResponse{status: status, header: header.Clone(), vary: vary, tags: strings.Fields(header.Get(surrogateKeyHeader))}
+	response.header.Del("X-Cache")
+	response.header.Del(surrogateKeyHeader)
+	response.setFreshness(config)
+
+	// Responses that are never fresh are only worth storing if they can be revalidated
+	if response.lifetime <= 0 && header.Get("ETag") == "" && header.Get("Last-Modified") == "" {
+		return nil
+	}
+	return response
+}
+
+// revalidated returns a copy of the response updated with the headers of a
+// 304 Not Modified response to a conditional request
+func (cr *cachedResponse) revalidated(header http.Header, config types.RouteCacheConfig) *cachedResponse {
+	updated := *cr
+	updated.header = cr.header.Clone()
+	for name, values := range header {
+		switch name {
+		case "Content-Length", "Content-Type", "Content-Encoding", "X-Cache", surrogateKeyHeader:
+			continue
+		}
+		updated.header[name] = slices.Clone(values)
+	}
+	updated.setFreshness(config)
+	return &updated
+}
+
+// setFreshness computes how long the response is fresh and may be served
+// stale from its headers, falling back to the route settings
+func (cr *cachedResponse) setFreshness(config types.RouteCacheConfig) {
+	directives := parseCacheControl(cr.header)
+	now := time.Now()
+
+	cr.date = now
+	cr.age = 0
+	if age, err := strconv.ParseInt(cr.header.Get("Age"), 10, 64); err == nil && age > 0 {
+		cr.age = time.Duration(age) * time.Second
+	}
+
+	maxAge, hasMaxAge := directives.duration("max-age")
+	if sharedMaxAge, exists := directives.duration("s-maxage"); exists && !config.Key.Consumer {
+		maxAge, hasMaxAge = sharedMaxAge, true
+	}
+
+	switch {
+	case directives.has("no-cache"):
+		cr.lifetime = 0
+	case hasMaxAge:
+		cr.lifetime = maxAge
+	case cr.header.Get("Expires") != "":
+		cr.lifetime = 0
+		if expires, err := http.ParseTime(cr.header.Get("Expires")); err == nil {
+			date, err := http.ParseTime(cr.header.Get("Date"))
+			if err != nil {
+				date = now
+			}
+			cr.lifetime = expires.Sub(date)
+		}
+	default:
+		cr.lifetime = config.TTL.Std()
+	}
+
+	cr.staleWhileRevalidate, cr.staleIfError = 0, 0
+	if directives.has("no-cache") || directives.has("must-revalidate") || directives.has("proxy-revalidate") {
+		return
+	}
+	if cr.staleWhileRevalidate = config.StaleWhileRevalidate.Std(); directives.has("stale-while-revalidate") {
+		cr.staleWhileRevalidate, _ = directives.duration("stale-while-revalidate")
+	}
+	if cr.staleIfError = config.StaleIfError.Std(); directives.has("stale-if-error") {
+		cr.staleIfError, _ = directives.duration("stale-if-error")
+	}
+}
+
+// currentAge returns the age of the response
+func (cr *cachedResponse) currentAge(now time.Time) time.Duration {
+	return cr.age + now.Sub(cr.date)
+}
+
+// staleness returns how long ago the response stopped being fresh, which is
+// negative while it is still fresh
+func (cr *cachedResponse) staleness(now time.Time) time.Duration {
+	return cr.currentAge(now) - cr.lifetime
+}
+
+// size returns the approximate memory used by the response
+func (cr *cachedResponse) size() int64 {
+	size := int64(len(cr.body))
+	for name, values := range cr.header {
+		size += int64(len(name))
+		for _, value := range values {
+			size += int64(len(value))
+		}
+	}
+	return size
+}
+
+// cacheRecorder records the response of the target. Unless the response is
+// held back for the cache to decide what to send, it is passed on to the
+// client as it arrives.
+type cacheRecorder struct {
+	client    http.ResponseWriter // Nil when nobody waits for the response
+	header    http.Header
+	status    int
+	body      bytes.Buffer
+	limit     int64
+	decide    func(status int, header http.Header) (*cachedResponse, bool)
+	entry     *cachedResponse // Response to store once the body is complete
+	held      bool            // The response is kept from the client
+	truncated bool            // The body exceeded the limit and is not recorded
+}
+
+// Header returns the response headers, which are the client's once the
+// response is passed on so that trailers reach it too
+func (rec *cacheRecorder) Header() http.Header {
+	if rec.passing() {
+		return rec.client.Header()
+	}
+	return rec.header
+}
+
+// WriteHeader decides whether to store, pass on or hold back the response
+func (rec *cacheRecorder) WriteHeader(status int) {
+	if rec.status != 0 {
+		return
+	}
+	rec.status = status
+	rec.entry, rec.held = rec.decide(status, rec.header)
+	if !rec.passing() {
+		return
+	}
+
+	h := rec.client.Header()
+	for name, values := range rec.header {
+		h[name] = values
+	}
+	h.Del(surrogateKeyHeader) // Meant for the cache only
+	h.Set("X-Cache", cacheMiss)
+	rec.client.WriteHeader(status)
+}
+
+// Write passes the body on to the client and records it while it fits the limit
+func (rec *cacheRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.WriteHeader(http.StatusOK)
+	}
+
+	if rec.entry != nil && !rec.truncated {
+		if int64(rec.body.Len()+len(b)) > rec.limit {
+			rec.truncated = true
+			rec.body = bytes.Buffer{}
+		} else {
+			rec.body.Write(b)
+		}
+	}
+
+	if !rec.passing() {
+		return len(b), nil
+	}
+	return rec.client.Write(b)
+}
+
+// Flush sends any buffered data to the client, as needed for streaming responses
+func (rec *cacheRecorder) Flush() {
+	if rec.passing() {
+		_ = http.NewResponseController(rec.client).Flush()
+	}
+}
+
+// passing reports whether the response is being passed on to the client
+func (rec *cacheRecorder) passing() bool {
+	return rec.status != 0 && !rec.held && rec.client != nil
+}
+
+// cacheControl holds the directives of Cache-Control headers by lower case name
+type cacheControl map[string]string
+
+// parseCacheControl parses the Cache-Control headers of a request or response
+func parseCacheControl(header http.Header) cacheControl {
+	directives := make(cacheControl)
+	for _, value := range header.Values("Cache-Control") {
+		for _, directive := range strings.Split(value, ",") {
+			name, argument, _ := strings.Cut(directive, "=")
+			if name = strings.ToLower(strings.TrimSpace(name)); name != "" {
+				directives[name] = strings.Trim(strings.TrimSpace(argument), `"`)
+			}
+		}
+	}
+	return directives
+}
+
+// has reports whether a directive is present
+func (cc cacheControl) has(name string) bool {
+	_, exists := cc[name]
+	return exists
+}
+
+// duration returns the number of seconds of a directive as a duration
+func (cc cacheControl) duration(name string) (time.Duration, bool) {
+	seconds, err := strconv.ParseInt(cc[name], 10, 64)
+	if err != nil || seconds < 0 {
+		return 0, false
+	}
+	return time.Duration(seconds) * time.Second, true
+}
+
+// cacheKey returns the key of the cached response for a request
+func cacheKey(service string, r *http.Request, config types.CacheKeyConfig) string {
+	var key strings.Builder
+	key.WriteString(service)
+	key.WriteByte('\n')
+	key.WriteString(strings.ToLower(r.Host))
+	key.WriteString(r.URL.EscapedPath())
+
+	if len(config.Query) == 0 {
+		if r.URL.RawQuery != "" {
+			key.WriteString("?" + r.URL.RawQuery)
+		}
+	} else {
+		// Only the selected parameters count, in a fixed order
+		query := r.URL.Query()
+		selected := make(url.Values)
+		for _, param := range config.Query {
+			if values, exists := query[param]; exists {
+				selected[param] = values
+			}
+		}
+		if len(selected) > 0 {
+			key.WriteString("?" + selected.Encode())
+		}
+	}
+
+	for _, name := range config.Headers {
+		key.WriteString("\n" + textproto.CanonicalMIMEHeaderKey(name) + ": " + strings.Join(r.Header.Values(name), ", "))
+	}
+
+	if config.Consumer {
+		key.WriteString("\nconsumer: " + consumerID(r))
+	}
+
+	return key.String()
+}
+
+// variantKey returns the key of the cached response for a request to a
+// resource whose responses vary by the given headers
+func variantKey(key string, vary []string, r *http.Request) string {
+	var variant strings.Builder
+	variant.WriteString(key)
+	for _, name := range vary {
+		variant.WriteString("\nvary " + name + ": " + strings.Join(r.Header.Values(name), ", "))
+	}
+	return variant.String()
+}
+
+// consumerID identifies the client credentials of a request by the hash of
+// its Authorization header or client certificate
+func consumerID(r *http.Request) string {
+	credentials := r.Header.Get("Authorization")
+	if credentials == "" && r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+		credentials = string(r.TLS.PeerCertificates[0].Raw)
+	}
+	if credentials == "" {
+		return ""
+	}
+
+	sum := sha256.Sum256([]byte(credentials))
+	return hex.EncodeToString(sum[:])
+}
+
+// varyHeaders returns the sorted canonical names of the request headers a
+// response varies by
+func varyHeaders(header http.Header) []string {
+	var names []string
+	for _, value := range header.Values("Vary") {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, textproto.CanonicalMIMEHeaderKey(name))
+			}
+		}
+	}
+	slices.Sort(names)
+	return slices.Compact(names)
+}
+
+// notModified reports whether the conditions of a request match a response
+// the client already has
+func notModified(r *http.Request, header http.Header) bool {
+	if match := r.Header.Get("If-None-Match"); match != "" {
+		etag := strings.TrimPrefix(header.Get("ETag"), "W/")
+		if etag == "" {
+			return false
+		}
+		for _, candidate := range strings.Split(match, ",") {
+			if candidate = strings.TrimSpace(candidate); candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+				return true
+			}
+		}
+		return false
+	}
+
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	lastModified, err := http.ParseTime(header.Get("Last-Modified"))
+	return err == nil && !lastModified.After(since)
+}
+
+// isUnsafeMethod reports whether requests with the method change the resource
+func isUnsafeMethod(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	}
+	return false
+}
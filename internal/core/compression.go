@@ -0,0 +1,362 @@
+package core
+
+import (
+	"AegisGate/pkg/types"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// zstdWindowSize is the largest window browsers accept for zstd responses
+const zstdWindowSize = 8 << 20
+
+// encoder compresses data written to it into an underlying writer
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+// encoderPools holds a pool of encoders for every encoding and level
+var encoderPools sync.Map
+
+// getEncoder returns an encoder writing to w
+func getEncoder(encoding string, level int, w io.Writer) encoder {
+	key := encoding + "/" + strconv.Itoa(level)
+	pool, _ := encoderPools.LoadOrStore(key, &sync.Pool{
+		New: func() any { return newEncoder(encoding, level) },
+	})
+
+	enc := pool.(*sync.Pool).Get().(encoder)
+	enc.Reset(w)
+	return enc
+}
+
+// putEncoder returns a closed encoder to its pool
+func putEncoder(encoding string, level int, enc encoder) {
+	if pool, exists := encoderPools.Load(encoding + "/" + strconv.Itoa(level)); exists {
+		enc.Reset(nil)
+		pool.(*sync.Pool).Put(enc)
+	}
+}
+
+// newEncoder creates an encoder for an encoding at a level from 1 to 9, or at
+// the default level of the encoding if level is 0
+func newEncoder(encoding string, level int) encoder {
+	switch encoding {
+	case types.EncodingBrotli:
+		if level == 0 {
+			level = brotli.DefaultCompression
+		}
+		return brotli.NewWriterLevel(nil, level)
+
+	case types.EncodingZstd:
+		zstdLevel := zstd.SpeedDefault
+		if level > 0 {
+			zstdLevel = zstd.EncoderLevelFromZstd(level)
+		}
+		enc, _ := zstd.NewWriter(nil,
+			zstd.WithEncoderLevel(zstdLevel),
+			zstd.WithEncoderConcurrency(1),
+			zstd.WithWindowSize(zstdWindowSize),
+		)
+		return enc
+
+	default:
+		if level == 0 {
+			level = gzip.DefaultCompression
+		}
+		enc, _ := gzip.NewWriterLevel(nil, level)
+		return enc
+	}
+}
+
+// compressWriter compresses the response of a route with the encoding
+// negotiated with the client. Responses without a Content-Length are held
+// back until they reach the minimum size, end or are flushed, so that small
+// responses are sent as they are and streams are compressed as they flow.
+type compressWriter struct {
+	http.ResponseWriter
+	config   types.CompressionConfig
+	encoding string // Empty if the client accepts none of the algorithms
+	head     bool
+	status   int
+	pending  []byte // Body written before deciding whether to compress it
+	decided  bool
+	encoder  encoder
+}
+
+// newCompressWriter creates a compressWriter for the response to r
+func newCompressWriter(w http.ResponseWriter, r *http.Request, config types.CompressionConfig) *compressWriter {
+	return &compressWriter{
+		ResponseWriter: w,
+		config:         config,
+		encoding:       negotiateEncoding(r.Header.Get("Accept-Encoding"), config.Algorithms),
+		head:           r.Method == http.MethodHead,
+	}
+}
+
+// WriteHeader decides whether to compress the response if its size is known
+func (cw *compressWriter) WriteHeader(status int) {
+	// Informational responses are passed on as they are
+	if status < http.StatusOK {
+		cw.ResponseWriter.WriteHeader(status)
+		return
+	}
+	if cw.status != 0 {
+		return
+	}
+	cw.status = status
+
+	h := cw.Header()
+	if !cw.compressible(status, h) {
+		_ = cw.start(false)
+		return
+	}
+
+	// The response depends on the encodings the client accepts
+	if !headerContains(h, "Vary", "Accept-Encoding") {
+		h.Add("Vary", "Accept-Encoding")
+	}
+	if cw.encoding == "" {
+		_ = cw.start(false)
+		return
+	}
+
+	if length, err := strconv.ParseInt(h.Get("Content-Length"), 10, 64); err == nil {
+		_ = cw.start(length >= int64(cw.config.MinSize))
+	}
+}
+
+// Write compresses the body, holding it back while its size is undecided
+func (cw *compressWriter) Write(b []byte) (int, error) {
+	if cw.status == 0 {
+		cw.WriteHeader(http.StatusOK)
+	}
+
+	if cw.decided {
+		if cw.encoder != nil {
+			return cw.encoder.Write(b)
+		}
+		return cw.ResponseWriter.Write(b)
+	}
+
+	cw.pending = append(cw.pending, b...)
+	if int64(len(cw.pending)) >= int64(cw.config.MinSize) {
+		if err := cw.start(true); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+// Flush sends the compressed data written so far to the client. A response
+// that is flushed before its size is decided is a stream and gets compressed.
+func (cw *compressWriter) Flush() {
+	if cw.status == 0 {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if !cw.decided {
+		_ = cw.start(true)
+	}
+	if cw.encoder != nil {
+		_ = cw.encoder.Flush()
+	}
+	_ = http.NewResponseController(cw.ResponseWriter).Flush()
+}
+
+// Unwrap returns the underlying http.ResponseWriter
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// Close sends responses that stayed below the minimum size and completes the
+// compressed stream. It must not be called if the handler was aborted, so that
+// an interrupted response does not look complete to the client.
+func (cw *compressWriter) Close() error {
+	if cw.status == 0 {
+		return nil
+	}
+	if !cw.decided {
+		if err := cw.start(false); err != nil {
+			return err
+		}
+	}
+	if cw.encoder == nil {
+		return nil
+	}
+
+	err := cw.encoder.Close()
+	putEncoder(cw.encoding, cw.config.Level, cw.encoder)
+	cw.encoder = nil
+	return err
+}
+
+// start writes the response headers and the body held back so far, compressed
+// or not
+func (cw *compressWriter) start(compress bool) error {
+	cw.decided = true
+
+	if compress {
+		h := cw.Header()
+		h.Del("Content-Length")
+		h.Del("Accept-Ranges")
+		h.Set("Content-Encoding", cw.encoding)
+		// The compressed body is no longer byte-for-byte the entity the target tagged
+		if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			h.Set("ETag", "W/"+etag)
+		}
+		cw.encoder = getEncoder(cw.encoding, cw.config.Level, cw.ResponseWriter)
+	}
+	cw.ResponseWriter.WriteHeader(cw.status)
+
+	pending := cw.pending
+	cw.pending = nil
+	if len(pending) == 0 {
+		return nil
+	}
+	if cw.encoder != nil {
+		_, err := cw.encoder.Write(pending)
+		return err
+	}
+	_, err := cw.ResponseWriter.Write(pending)
+	return err
+}
+
+// compressible reports whether a response may be compressed
+func (cw *compressWriter) compressible(status int, h http.Header) bool {
+	switch {
+	case cw.head, status == http.StatusNoContent, status == http.StatusNotModified, status == http.StatusPartialContent:
+		return false
+	case h.Get("Content-Encoding") != "":
+		return false
+	case headerContains(h, "Cache-Control", "no-transform"):
+		return false
+	}
+
+	mediaType, _, _ := strings.Cut(h.Get("Content-Type"), ";")
+	mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+	if mediaType == "" {
+		return false
+	}
+	for _, contentType := range cw.config.ContentTypes {
+		if strings.HasPrefix(mediaType, strings.ToLower(contentType)) {
+			return true
+		}
+	}
+	return false
+}
+
+// negotiateEncoding returns the offered encoding the client accepts with the
+// highest quality, preferring earlier ones on ties, or an empty string if it
+// accepts none of them
+func negotiateEncoding(acceptEncoding string, offered []string) string {
+	qualities := make(map[string]float64)
+	wildcard := 0.0
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(part, ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+
+		quality := 1.0
+		for _, param := range strings.Split(params, ";") {
+			if value, found := strings.CutPrefix(strings.TrimSpace(param), "q="); found {
+				if q, err := strconv.ParseFloat(value, 64); err == nil {
+					quality = q
+				}
+			}
+		}
+
+		switch name {
+		case "":
+		case "*":
+			wildcard = quality
+		default:
+			qualities[name] = quality
+		}
+	}
+
+	best, bestQuality := "", 0.0
+	for _, encoding := range offered {
+		quality, exists := qualities[encoding]
+		if !exists {
+			quality = wildcard
+		}
+		if quality > bestQuality {
+			best, bestQuality = encoding, quality
+		}
+	}
+	return best
+}
+
+// headerContains reports whether a comma-separated header contains a token
+func headerContains(h http.Header, name, token string) bool {
+	for _, value := range h.Values(name) {
+		for _, element := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(element), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// decompressedBody reads a decompressed request body and closes both the
+// decompressor and the original body
+type decompressedBody struct {
+	io.Reader
+	closers []io.Closer
+}
+
+// Close closes the decompressor and the original body
+func (b *decompressedBody) Close() error {
+	var err error
+	for _, closer := range b.closers {
+		if closeErr := closer.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// decompressRequest replaces a request body compressed with gzip, br or zstd
+// by its decompressed content. Bodies with other encodings are left as they are.
+func decompressRequest(r *http.Request) error {
+	encoding := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding")))
+
+	var body *decompressedBody
+	switch encoding {
+	case types.EncodingGzip:
+		reader, err := gzip.NewReader(r.Body)
+		if err != nil {
+			return fmt.Errorf("invalid gzip body: %w", err)
+		}
+		body = &decompressedBody{Reader: reader, closers: []io.Closer{reader, r.Body}}
+
+	case types.EncodingBrotli:
+		body = &decompressedBody{Reader: brotli.NewReader(r.Body), closers: []io.Closer{r.Body}}
+
+	case types.EncodingZstd:
+		decoder, err := zstd.NewReader(r.Body, zstd.WithDecoderConcurrency(1), zstd.WithDecoderMaxWindow(zstdWindowSize))
+		if err != nil {
+			return fmt.Errorf("invalid zstd body: %w", err)
+		}
+		reader := decoder.IOReadCloser()
+		body = &decompressedBody{Reader: reader, closers: []io.Closer{reader, r.Body}}
+
+	default:
+		return nil
+	}
+
+	r.Body = body
+	r.ContentLength = -1
+	r.Header.Del("Content-Encoding")
+	r.Header.Del("Content-Length")
+	return nil
+}
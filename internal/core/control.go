@@ -0,0 +1,210 @@
+package core
+
+import (
+	"AegisGate/internal/health"
+	"AegisGate/internal/logger"
+	"AegisGate/pkg/types"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// RouteInfo describes a route registered on the gateway router
+type RouteInfo struct {
+	Method    string   `json:"method"`
+	Path      string   `json:"path"`
+	Service   string   `json:"service"`
+	Target    string   `json:"target"`
+	Listeners []string `json:"listeners"`
+	Enabled   bool     `json:"enabled"`
+}
+
+// routeKey returns the key used to identify a route
+func routeKey(method, path string) string {
+	return method + " " + path
+}
+
+// Config returns the configuration currently applied to the gateway
+func (g *Gateway) Config() *types.Config {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.config
+}
+
+// Routes returns the routes registered on the gateway
+func (g *Gateway) Routes() []RouteInfo {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	routes := make([]RouteInfo, len(g.routes))
+	for i, route := range g.routes {
+		route.Enabled = !g.disabledRoutes[routeKey(route.Method, route.Path)]
+		routes[i] = route
+	}
+
+	return routes
+}
+
+// Targets returns the status of the targets of all services, ordered by service name
+func (g *Gateway) Targets() []health.Status {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	statuses := make([]health.Status, 0, len(g.targets))
+	for _, target := range g.targets {
+		statuses = append(statuses, target.Status())
+	}
+	for _, s := range g.tcpServices {
+		statuses = append(statuses, l4Statuses(s.state.Load().targets)...)
+	}
+	for _, s := range g.udpServices {
+		statuses = append(statuses, l4Statuses(s.state.Load().targets)...)
+	}
+	sort.SliceStable(statuses, func(i, j int) bool {
+		return statuses[i].Name < statuses[j].Name
+	})
+
+	return statuses
+}
+
+// SetTargetDrained drains or restores the target of a service, or all targets
+// of a TCP or UDP service
+func (g *Gateway) SetTargetDrained(serviceName string, drained bool) error {
+	g.mu.RLock()
+	target, exists := g.targets[serviceName]
+	var serviceTargets map[string]*l4Target
+	if s, ok := g.tcpServices[serviceName]; ok {
+		serviceTargets = s.state.Load().targets
+	} else if s, ok := g.udpServices[serviceName]; ok {
+		serviceTargets = s.state.Load().targets
+	}
+	g.mu.RUnlock()
+
+	if serviceTargets != nil {
+		for _, target := range serviceTargets {
+			target.health.SetDrained(drained)
+		}
+		g.logger.Info("Targets of service %s drained: %t", serviceName, drained)
+		return nil
+	}
+
+	if !exists {
+		return fmt.Errorf("target not found for service: %s", serviceName)
+	}
+
+	target.SetDrained(drained)
+	g.logger.Info("Target of service %s drained: %t", serviceName, drained)
+	return nil
+}
+
+// SetRouteEnabled enables or disables a registered route at runtime. Disabled
+// routes stay disabled across reloads for as long as they are configured.
+func (g *Gateway) SetRouteEnabled(method, path string, enabled bool) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	key := routeKey(method, path)
+	found := false
+	for _, route := range g.routes {
+		if routeKey(route.Method, route.Path) == key {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return fmt.Errorf("route not found: %s", key)
+	}
+
+	if enabled {
+		delete(g.disabledRoutes, key)
+	} else {
+		g.disabledRoutes[key] = true
+	}
+	g.logger.Info("Route %s enabled: %t", key, enabled)
+	return nil
+}
+
+// CachePurge selects the cached responses to remove: those of a key, of keys
+// with a prefix or with a tag, optionally limited to a service, or all
+// responses of a service. Keys are the host and path with query of a request,
+// or only its path to match any host.
+type CachePurge struct {
+	Service string `json:"service,omitempty"`
+	Key     string `json:"key,omitempty"`
+	Prefix  string `json:"prefix,omitempty"`
+	Tag     string `json:"tag,omitempty"` // Surrogate key set by the target
+}
+
+// PurgeCache removes cached responses and returns how many were removed
+func (g *Gateway) PurgeCache(purge CachePurge) (int, error) {
+	g.mu.RLock()
+	_, exists := g.targets[purge.Service]
+	g.mu.RUnlock()
+	if purge.Service != "" && !exists {
+		return 0, fmt.Errorf("service not found: %s", purge.Service)
+	}
+
+	inService := func(item *cacheItem) bool {
+		return purge.Service == "" || item.service == purge.Service
+	}
+
+	var purged int
+	switch {
+	case purge.Key != "":
+		purged = g.cache.purge(purgeKey, func(item *cacheItem) bool {
+			return inService(item) && item.matchesKey(purge.Key, false)
+		})
+	case purge.Prefix != "":
+		purged = g.cache.purge(purgePrefix, func(item *cacheItem) bool {
+			return inService(item) && item.matchesKey(purge.Prefix, true)
+		})
+	case purge.Tag != "":
+		purged = g.cache.purge(purgeTag, func(item *cacheItem) bool {
+			return inService(item) && item.response != nil && slices.Contains(item.response.tags, purge.Tag)
+		})
+	case purge.Service != "":
+		purged = g.cache.purge(purgeService, inService)
+	default:
+		return 0, fmt.Errorf("a service, key, prefix or tag is required")
+	}
+
+	g.logger.Info("Purged %d cached responses (%s)", purged, purge)
+	return purged, nil
+}
+
+// String describes what a purge selects
+func (p CachePurge) String() string {
+	var parts []string
+	for _, part := range []struct{ name, value string }{
+		{"service", p.Service}, {"key", p.Key}, {"prefix", p.Prefix}, {"tag", p.Tag},
+	} {
+		if part.value != "" {
+			parts = append(parts, part.name+"="+part.value)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// SetPurgeAuthorizer enables PURGE requests on the gateway listeners for
+// clients that authorize reports as allowed to purge
+func (g *Gateway) SetPurgeAuthorizer(authorize func(r *http.Request) bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.purgeAuthorizer = authorize
+}
+
+// routeEnabled reports whether a route has not been disabled at runtime
+func (g *Gateway) routeEnabled(method, path string) bool {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return !g.disabledRoutes[routeKey(method, path)]
+}
+
+// requestLogger returns the request logger of the current configuration
+func (g *Gateway) requestLogger() *logger.RequestLogger {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.reqLogger
+}
@@ -1,76 +1,240 @@
 package core
 
 import (
+	"AegisGate/internal/health"
 	"AegisGate/internal/logger"
 	"AegisGate/pkg/types"
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"net/url"
+	"reflect"
+	"slices"
 	"strings"
 	"sync"
-	"time"
+	"sync/atomic"
 
 	"github.com/julienschmidt/httprouter"
 )
 
 // Gateway represents the API gateway
 type Gateway struct {
-	config    *types.Config
-	router    *httprouter.Router
-	proxies   *ProxyManager
-	server    *http.Server
-	logger    *logger.Logger
-	reqLogger *logger.RequestLogger
-	mu        sync.RWMutex
+	config          *types.Config
+	routers         map[string]*httprouter.Router
+	proxies         *ProxyManager
+	targets         map[string]*health.Target
+	transports      map[string]*transport
+	routes          []RouteInfo
+	disabledRoutes  map[string]bool
+	servers         []*listenerServer
+	tcpServices     map[string]*tcpService
+	udpServices     map[string]*udpService
+	listen          ListenFunc
+	listenPacket    ListenPacketFunc
+	conns           *connTracker
+	limiter         *connLimiter
+	websockets      *websocketTracker
+	cache           *responseCache
+	purgeAuthorizer func(r *http.Request) bool
+	ready           atomic.Bool
+	logger          *logger.Logger
+	reqLogger       *logger.RequestLogger
+	mu              sync.RWMutex
 }
 
 // New creates a new Gateway instance
 func New(config *types.Config) (*Gateway, error) {
-	l := logger.New(config.Server.Debug)
+	l, err := newLogger(config.Server)
+	if err != nil {
+		return nil, err
+	}
 
 	g := &Gateway{
-		config:    config,
-		router:    httprouter.New(),
-		proxies:   NewProxyManager(config.Server.Debug),
-		logger:    l,
-		reqLogger: logger.NewRequestLogger(l, "AegisGate"),
+		targets:        make(map[string]*health.Target),
+		transports:     make(map[string]*transport),
+		disabledRoutes: make(map[string]bool),
+		listen:         defaultListen,
+		listenPacket:   defaultListenPacket,
+		conns:          newConnTracker(),
+		limiter:        newConnLimiter(config.Server.Connections, l),
+		websockets:     newWebSocketTracker(),
+		cache:          newResponseCache(config.Server.Cache),
+		logger:         l,
+		reqLogger:      logger.NewRequestLogger(l, "AegisGate"),
 	}
 
 	g.logger.Debug("Debug mode enabled")
 
 	// Initialize routes
-	if err := g.initializeRoutes(); err != nil {
+	if err := g.initializeRoutes(config, l); err != nil {
 		return nil, fmt.Errorf("failed to initialize routes: %w", err)
 	}
+	g.configureL4Services(config, l)
 
 	return g, nil
 }
 
-// initializeRoutes sets up all the routes from the configuration
-func (g *Gateway) initializeRoutes() error {
+// newLogger creates the gateway logger with the configured request dump redaction
+func newLogger(server types.ServerConfig) (*logger.Logger, error) {
+	redactor, err := logger.NewRedactor(server.DebugDump)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create redactor: %w", err)
+	}
+	return logger.NewWithRedactor(server.Debug, redactor), nil
+}
+
+// initializeRoutes builds a router for every listener, and the proxies and
+// targets for the configuration, and swaps them in once every service has been
+// set up successfully. The caller must hold the write lock or have exclusive
+// access to the gateway.
+func (g *Gateway) initializeRoutes(config *types.Config, l *logger.Logger) error {
+	listeners := config.Server.GetListeners()
+	routers := make(map[string]*httprouter.Router, len(listeners))
+	proxies := NewProxyManager(l)
+	targets := make(map[string]*health.Target)
+	transports := make(map[string]*transport)
+	routes := make([]RouteInfo, 0)
+	websocketRoutes := make(map[string]websocketRoute)
+	schemas := newSchemaCompiler()
+
 	// Set up default routes
-	g.router.NotFound = g.handleNotFound()
-	g.router.GET("/health", g.handleHealthCheck)
+	for _, listener := range listeners {
+		router := httprouter.New()
+		router.NotFound = g.handleNotFound()
+		router.GET(config.Server.Health.LivenessPath, g.handleLiveness)
+		router.GET(config.Server.Health.ReadinessPath, g.handleReadiness)
+		if health := config.Server.Health; health.LivenessPath != types.LegacyHealthPath && health.ReadinessPath != types.LegacyHealthPath {
+			router.GET(types.LegacyHealthPath, g.handleLiveness)
+		}
+		routers[listener.Name] = router
+	}
+
+	for _, service := range config.Services {
+		// Find the listeners serving this service
+		serviceListeners := make([]string, 0, len(listeners))
+		for _, listener := range listeners {
+			if listener.Serves(service.Name) {
+				serviceListeners = append(serviceListeners, listener.Name)
+			}
+		}
+
+		// Keep the health state of targets that survive a reload
+		target, exists := g.targets[service.Name]
+		if !exists || target.Address() != service.TargetURL {
+			target = health.NewTarget(service.Name, service.TargetURL, service.CircuitBreaker)
+		} else {
+			target.SetCircuitBreaker(service.CircuitBreaker)
+		}
+		targets[service.Name] = target
+
+		// Keep the connection pools of unchanged services
+		transport, exists := g.transports[service.Name]
+		if !exists || !transport.reusableFor(service) {
+			targetURL, err := url.Parse(service.TargetURL)
+			if err != nil {
+				return fmt.Errorf("invalid target URL for service %s: %w", service.Name, err)
+			}
+			transport = newTransport(service.GetTransport(), targetURL)
+		}
+		transports[service.Name] = transport
 
-	for _, service := range g.config.Services {
 		// Add service to proxy manager
-		if err := g.proxies.AddService(service); err != nil {
+		if err := proxies.AddService(service, target, transport); err != nil {
 			return fmt.Errorf("failed to add service proxy: %w", err)
 		}
 
+		// Load the descriptors of services with routes transcoded to gRPC
+		transcoder, err := newTranscoder(service)
+		if err != nil {
+			return fmt.Errorf("failed to set up transcoding for service %s: %w", service.Name, err)
+		}
+		serviceRoutes := service.Routes
+		if transcoder != nil && service.Transcoding.Annotations {
+			// Annotated bindings must not conflict with the configured routes
+			configured := newRouteSet()
+			for _, route := range service.Routes {
+				if routerPath, _, err := g.routePath(service, route, transcoder); err == nil {
+					for _, method := range route.GetMethods() {
+						_ = configured.add(method.String(), routerPath)
+					}
+				}
+			}
+			annotated, err := transcoder.annotatedRoutes(l, configured)
+			if err != nil {
+				return fmt.Errorf("invalid annotations of service %s: %w", service.Name, err)
+			}
+			serviceRoutes = append(slices.Clip(serviceRoutes), annotated...)
+		}
+
 		// Set up routes for the service
-		for _, route := range service.Routes {
-			routerPath := g.convertPath(service.BasePath, route.Path)
+		for _, route := range serviceRoutes {
+			routerPath, transcoded, err := g.routePath(service, route, transcoder)
+			if err != nil {
+				return fmt.Errorf("invalid transcoded route %s of service %s: %w", route.Path, service.Name, err)
+			}
+
+			// Compile the schemas requests to the route are validated against
+			validator, err := newRequestValidator(schemas, route.Validation)
+			if err != nil {
+				return fmt.Errorf("invalid validation of route %s of service %s: %w", route.Path, service.Name, err)
+			}
+
+			if route.WebSocket.Enabled {
+				websocketRoutes[routerPath] = websocketRoute{service: service.Name, target: service.TargetURL}
+			}
 
 			// Use GetMethods() to get the expanded list of methods
 			for _, method := range route.GetMethods() {
-				handler := g.createHandler(service, route)
-				g.router.Handle(method.String(), routerPath, handler)
-				g.logger.Debug("Registered route: %s %s -> %s", method, routerPath, service.TargetURL)
+				handler := g.createHandler(proxies, config.Server, service, route, transcoded, validator, method.String(), routerPath)
+				for _, name := range serviceListeners {
+					if err := handleRoute(routers[name], method.String(), routerPath, handler); err != nil {
+						return fmt.Errorf("invalid route %s %s of service %s: %w", method, routerPath, service.Name, err)
+					}
+				}
+				routes = append(routes, RouteInfo{
+					Method:    method.String(),
+					Path:      routerPath,
+					Service:   service.Name,
+					Target:    service.TargetURL,
+					Listeners: serviceListeners,
+				})
+				l.Debug("Registered route: %s %s -> %s on %v", method, routerPath, service.TargetURL, serviceListeners)
 			}
 		}
 	}
 
+	// Forget disabled routes that are no longer configured
+	registered := make(map[string]bool, len(routes))
+	for _, route := range routes {
+		registered[routeKey(route.Method, route.Path)] = true
+	}
+	for key := range g.disabledRoutes {
+		if !registered[key] {
+			delete(g.disabledRoutes, key)
+		}
+	}
+
+	// Release the idle connections of transports that were replaced
+	for name, transport := range g.transports {
+		if transports[name] != transport {
+			transport.CloseIdleConnections()
+		}
+	}
+
+	g.config = config
+	g.routers = routers
+	g.proxies = proxies
+	g.targets = targets
+	g.transports = transports
+	g.routes = routes
+
+	// Close WebSocket connections whose route is gone or proxies elsewhere now
+	if closed := g.websockets.CloseStale(websocketRoutes); closed > 0 {
+		l.Info("Closed %d WebSocket connections of changed routes", closed)
+	}
+
 	return nil
 }
 
@@ -95,42 +259,340 @@ func (g *Gateway) convertPath(basePath, routePath string) string {
 	return strings.Join(segments, "/")
 }
 
+// routePath returns the router path of a route, and the gRPC method binding
+// of transcoded routes
+func (g *Gateway) routePath(service types.ServiceConfig, route types.Route, transcoder *transcoder) (string, *transcodedRoute, error) {
+	if !route.IsTranscoded() {
+		return g.convertPath(service.BasePath, route.Path), nil, nil
+	}
+
+	transcoded, err := transcoder.bind(route)
+	if err != nil {
+		return "", nil, err
+	}
+	return transcoded.path, transcoded, nil
+}
+
+// handleRoute registers a handler on a router. httprouter panics on a path
+// that conflicts with the paths registered before, which is returned as an
+// error so that a reload fails instead of crashing the gateway.
+func handleRoute(router *httprouter.Router, method, path string, handler httprouter.Handle) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+
+	router.Handle(method, path, handler)
+	return nil
+}
+
+// routeSet detects router paths that conflict with the ones added before
+type routeSet struct {
+	router *httprouter.Router
+}
+
+// newRouteSet creates an empty routeSet
+func newRouteSet() *routeSet {
+	return &routeSet{router: httprouter.New()}
+}
+
+// add adds a method and router path, unless it conflicts with the ones added before
+func (s *routeSet) add(method, path string) error {
+	return handleRoute(s.router, method, path, func(http.ResponseWriter, *http.Request, httprouter.Params) {})
+}
+
 // createHandler creates a handler function for a specific route
-func (g *Gateway) createHandler(service types.ServiceConfig, route types.Route) httprouter.Handle {
+func (g *Gateway) createHandler(proxies *ProxyManager, server types.ServerConfig, service types.ServiceConfig, route types.Route, transcoded *transcodedRoute, validator *requestValidator, method, routerPath string) httprouter.Handle {
+	timeout := route.GetTimeout(service)
+	timeouts := route.GetTimeouts(service)
+	maxBodySize := int64(route.GetMaxBodySize(service, server))
+	if maxBodySize == 0 && validator != nil && validator.body != nil {
+		maxBodySize = defaultValidatedBodySize
+	}
+	contentTypes := route.GetContentTypes(service)
+
 	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		// Routes disabled at runtime behave as if they were not configured
+		if !g.routeEnabled(method, routerPath) {
+			g.handleNotFound().ServeHTTP(w, r)
+			return
+		}
+
 		// Get the proxy for this service
-		proxy, err := g.proxies.GetProxy(service.Name)
+		proxy, err := proxies.GetProxy(service.Name)
 		if err != nil {
-			http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+			httpError(w, r, "Service Unavailable", http.StatusServiceUnavailable)
+			return
+		}
+
+		// WebSocket connections are bounded by their own timeouts
+		if isWebSocketUpgrade(r) {
+			g.serveWebSocket(w, r, proxy, service, route, routerPath)
+			return
+		}
+
+		forward := func(w http.ResponseWriter, r *http.Request) {
+			// Apply the route timeouts
+			r, release := withTimeouts(r, timeout, timeouts, route.FlushInterval != 0)
+			defer release()
+
+			// Call the gRPC method of transcoded routes
+			if transcoded != nil {
+				transcoded.ServeHTTP(w, r, ps, proxy, route)
+				return
+			}
+
+			// Copy URL parameters to request
+			for _, p := range ps {
+				r.URL.Query().Set(p.Key, p.Value)
+			}
+
+			// Forward the request to the target service
+			proxy.ServeHTTP(w, r, route)
+		}
+
+		// Reject bodies the route does not accept before reading them
+		if !acceptsContentType(r, contentTypes) {
+			httpError(w, r, "Unsupported Media Type", http.StatusUnsupportedMediaType)
+			return
+		}
+		if maxBodySize > 0 && r.ContentLength > maxBodySize {
+			httpError(w, r, "Request Entity Too Large", http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		// Decompress request bodies for targets that cannot
+		if route.Compression.DecompressRequests {
+			if err := decompressRequest(r); err != nil {
+				httpError(w, r, "Bad Request", http.StatusBadRequest)
+				return
+			}
+		}
+
+		// Bodies without a length, and decompressed bodies, are limited as they are read
+		if maxBodySize > 0 {
+			r.Body = http.MaxBytesReader(w, r.Body, maxBodySize)
+		}
+
+		// Reject requests that do not match the schemas of the route
+		if validator != nil {
+			violations, err := validator.validate(r)
+			switch {
+			case errors.Is(err, errUnsupportedBody):
+				httpError(w, r, "Unsupported Media Type", http.StatusUnsupportedMediaType)
+				return
+			case isBodyTooLarge(err):
+				httpError(w, r, "Request Entity Too Large", http.StatusRequestEntityTooLarge)
+				return
+			case err != nil:
+				httpError(w, r, "Bad Request", http.StatusBadRequest)
+				return
+			case len(violations) > 0:
+				validationFailuresTotal.Inc(service.Name, violations[0].Location)
+				writeViolations(w, r, violations)
+				return
+			}
+		}
+
+		// Compress responses for clients that accept it. Responses aborted by a
+		// panic are not completed, so that clients see them as interrupted.
+		var compressor *compressWriter
+		if route.Compression.Enabled {
+			compressor = newCompressWriter(w, r, route.Compression)
+			w = compressor
+		}
+
+		// Serve cached responses of the route, fetching the others from the target
+		if route.Cache.Enabled {
+			g.cache.serve(w, r, service.Name, route.Cache, proxies.logger, forward)
+		} else {
+			forward(w, r)
+		}
+
+		if compressor != nil {
+			_ = compressor.Close()
+		}
+	}
+}
+
+// listenerHandler returns a handler that dispatches requests to the router of
+// a listener in the current configuration
+func (g *Gateway) listenerHandler(name string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		g.mu.RLock()
+		router, exists := g.routers[name]
+		authorizePurge := g.purgeAuthorizer
+		server := g.config.Server
+		g.mu.RUnlock()
+
+		if !checkHeaders(r, server) {
+			httpError(w, r, "Request Header Fields Too Large", http.StatusRequestHeaderFieldsTooLarge)
 			return
 		}
 
-		// Apply timeout if specified
-		if route.Timeout > 0 {
-			ctx, cancel := context.WithTimeout(r.Context(), time.Duration(route.Timeout)*time.Second)
-			defer cancel()
-			r = r.WithContext(ctx)
+		if r.Method == methodPurge && authorizePurge != nil {
+			g.handlePurge(w, r, authorizePurge)
+			return
 		}
 
-		// Copy URL parameters to request
-		for _, p := range ps {
-			r.URL.Query().Set(p.Key, p.Value)
+		if !exists {
+			g.handleNotFound().ServeHTTP(w, r)
+			return
 		}
+		router.ServeHTTP(w, r)
+	})
+}
+
+// SetListenFunc sets the function used to create the gateway listeners
+func (g *Gateway) SetListenFunc(listen ListenFunc) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.listen = listen
+}
 
-		// Forward the request to the target service
-		proxy.ServeHTTP(w, r, route.StripPath)
+// SetListenPacketFunc sets the function used to create the UDP sockets of HTTP/3 listeners
+func (g *Gateway) SetListenPacketFunc(listenPacket ListenPacketFunc) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.listenPacket = listenPacket
+}
+
+// Listen binds every configured listener and marks the gateway as serving.
+// Connections are accepted once Serve is called.
+func (g *Gateway) Listen() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	listeners := g.config.Server.GetListeners()
+	servers := make([]*listenerServer, 0, len(listeners))
+	var bound []io.Closer
+	closeAll := func() {
+		for _, s := range servers {
+			_ = s.listener.Close()
+			if s.packetConn != nil {
+				_ = s.packetConn.Close()
+			}
+		}
+		for _, c := range bound {
+			_ = c.Close()
+		}
 	}
+
+	for _, listener := range listeners {
+		s, err := newListenerServer(listener, g.listenerHandler(listener.Name))
+		if err != nil {
+			closeAll()
+			return err
+		}
+
+		ln, err := g.bind(listener)
+		if err != nil {
+			closeAll()
+			return fmt.Errorf("failed to listen on %s: %w", listener.Address, err)
+		}
+		s.listener = ln
+		servers = append(servers, s)
+
+		if listener.HTTP3.Enabled {
+			pc, err := g.listenPacket(http3Name(listener.Name), "udp", listener.HTTP3.Address)
+			if err != nil {
+				closeAll()
+				return fmt.Errorf("failed to listen on %s/udp: %w", listener.HTTP3.Address, err)
+			}
+			s.packetConn = pc
+		}
+	}
+
+	for _, service := range g.config.TCPServices {
+		ln, err := g.listen(tcpName(service.Name), "tcp", service.Listen)
+		if err != nil {
+			closeAll()
+			return fmt.Errorf("failed to listen on %s for tcp service %s: %w", service.Listen, service.Name, err)
+		}
+		bound = append(bound, ln)
+		s := g.tcpServices[service.Name]
+		s.listener = s.conns.Listener(ln)
+	}
+
+	for _, service := range g.config.UDPServices {
+		pc, err := g.listenPacket(udpName(service.Name), "udp", service.Listen)
+		if err != nil {
+			closeAll()
+			return fmt.Errorf("failed to listen on %s/udp for udp service %s: %w", service.Listen, service.Name, err)
+		}
+		bound = append(bound, pc)
+		g.udpServices[service.Name].conn = pc
+	}
+
+	g.servers = servers
+	g.SetReady(true)
+
+	return nil
 }
 
-// Start starts the gateway server
-func (g *Gateway) Start() error {
-	addr := fmt.Sprintf("%s:%d", g.config.Server.Host, g.config.Server.Port)
-	g.logger.Info("Starting gateway server on %s", addr)
-	g.server = &http.Server{
-		Addr:    addr,
-		Handler: g.router,
+// Serve accepts connections on the listeners bound by Listen. It returns when
+// all listeners have been shut down or as soon as one of them fails.
+func (g *Gateway) Serve() error {
+	g.mu.RLock()
+	servers := g.servers
+	tcpServices, udpServices := g.tcpServices, g.udpServices
+	g.mu.RUnlock()
+
+	if len(servers) == 0 {
+		return fmt.Errorf("gateway is not listening")
+	}
+
+	errs := make(chan error, 2*len(servers)+len(tcpServices)+len(udpServices))
+	running := 0
+	for _, s := range servers {
+		g.logger.Info("Starting gateway listener %s (%s) on %s", s.config.Name, s.config.Protocol, s.listener.Addr())
+		listener := s.listener
+		if s.config.ProxyProtocol.Enabled {
+			listener = newProxyProtocolListener(listener, s.config.ProxyProtocol, g.logger)
+		}
+		go func() {
+			errs <- s.serve(g.conns.Listener(g.limiter.Listener(listener)))
+		}()
+		running++
+
+		if s.http3 != nil {
+			g.logger.Info("Starting HTTP/3 for gateway listener %s on %s/udp", s.config.Name, s.packetConn.LocalAddr())
+			go func() {
+				errs <- s.serveHTTP3()
+			}()
+			running++
+		}
+	}
+
+	for _, s := range tcpServices {
+		g.logger.Info("Starting TCP service %s on %s", s.name, s.listener.Addr())
+		go func() {
+			errs <- s.serve()
+		}()
+		running++
+	}
+
+	for _, s := range udpServices {
+		g.logger.Info("Starting UDP service %s on %s/udp", s.name, s.conn.LocalAddr())
+		go func() {
+			errs <- s.serve()
+		}()
+		running++
+	}
+
+	for range running {
+		if err := <-errs; !errors.Is(err, http.ErrServerClosed) {
+			return fmt.Errorf("listener failed: %w", err)
+		}
 	}
-	return g.server.ListenAndServe()
+	return http.ErrServerClosed
+}
+
+// SetReady sets whether the gateway is serving traffic. The readiness
+// endpoint fails while the gateway is not serving.
+func (g *Gateway) SetReady(ready bool) {
+	g.ready.Store(ready)
 }
 
 // OnConfigChange updates the gateway configuration
@@ -138,24 +600,123 @@ func (g *Gateway) OnConfigChange(newConfig *types.Config) error {
 	g.mu.Lock()
 	defer g.mu.Unlock()
 
-	// Create new router and proxy manager
-	newRouter := httprouter.New()
-	newProxies := NewProxyManager(newConfig.Server.Debug)
+	// Create new logger, router and proxy manager
+	l, err := newLogger(newConfig.Server)
+	if err != nil {
+		return err
+	}
 
-	// Initialize new routes with new configuration
-	g.config = newConfig
-	g.router = newRouter
-	g.proxies = newProxies
+	// Listeners are bound once, so only the services they serve may change
+	if g.servers != nil {
+		if err := checkListeners(g.servers, newConfig.Server.GetListeners()); err != nil {
+			return err
+		}
+		if err := checkL4Services(newConfig, g.tcpServices, g.udpServices); err != nil {
+			return err
+		}
+
+		// The admin API is started once with its address and credentials
+		if !reflect.DeepEqual(g.config.Admin, newConfig.Admin) {
+			return fmt.Errorf("admin settings changed, restart or upgrade the gateway to apply")
+		}
+	}
 
-	if err := g.initializeRoutes(); err != nil {
+	// Initialize new routes with new configuration
+	if err := g.initializeRoutes(newConfig, l); err != nil {
 		return fmt.Errorf("failed to initialize routes: %w", err)
 	}
+	g.configureL4Services(newConfig, l)
+
+	g.logger = l
+	g.reqLogger = logger.NewRequestLogger(l, "AegisGate")
+	g.limiter.SetLimits(newConfig.Server.Connections, l)
+	g.cache.SetLimits(newConfig.Server.Cache)
 
 	return nil
 }
 
-// Close shuts down the gateway
-func (g *Gateway) Close() error {
+// Shutdown stops accepting new connections and waits for in-flight requests
+// to complete until ctx is done. Connections that are still open afterwards,
+// including hijacked ones such as upgraded WebSockets, are closed forcibly.
+func (g *Gateway) Shutdown(ctx context.Context) error {
 	g.logger.Debug("Shutting down gateway server")
-	return g.server.Shutdown(context.Background())
+	g.SetReady(false)
+
+	g.mu.RLock()
+	servers := g.servers
+	tcpServices, udpServices := g.tcpServices, g.udpServices
+	g.mu.RUnlock()
+
+	// Stop all listeners at once so that none keeps accepting while another drains
+	errs := make([]error, len(servers), len(servers)+len(tcpServices))
+	var wg sync.WaitGroup
+	for i, s := range servers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = s.shutdown(ctx)
+		}()
+	}
+	for _, s := range tcpServices {
+		if s.listener == nil {
+			continue
+		}
+		errs = append(errs, nil)
+		i := len(errs) - 1
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := s.shutdown(ctx); err != nil {
+				errs[i] = fmt.Errorf("tcp service %s: %w", s.name, err)
+			}
+		}()
+	}
+
+	// Datagrams carry no connection state, so UDP services stop right away
+	for _, s := range udpServices {
+		if s.conn != nil {
+			_ = s.close()
+		}
+	}
+	wg.Wait()
+
+	if closed := g.websockets.CloseAll(); closed > 0 {
+		g.logger.Info("Closing %d WebSocket connections", closed)
+	}
+	if closed := g.conns.CloseAll(); closed > 0 {
+		g.logger.Info("Closed %d remaining connections", closed)
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("failed to drain connections: %w", err)
+	}
+	return nil
+}
+
+// Close shuts down the gateway immediately, closing all connections
+func (g *Gateway) Close() error {
+	g.logger.Debug("Closing gateway server")
+	g.SetReady(false)
+
+	g.mu.RLock()
+	servers := g.servers
+	tcpServices, udpServices := g.tcpServices, g.udpServices
+	g.mu.RUnlock()
+
+	errs := make([]error, 0, len(servers))
+	for _, s := range servers {
+		errs = append(errs, s.close())
+	}
+	for _, s := range tcpServices {
+		if s.listener != nil {
+			errs = append(errs, s.close())
+		}
+	}
+	for _, s := range udpServices {
+		if s.conn != nil {
+			errs = append(errs, s.close())
+		}
+	}
+	g.conns.CloseAll()
+	return errors.Join(errs...)
 }
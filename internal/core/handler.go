@@ -1,24 +1,166 @@
 package core
 
 import (
-	"github.com/julienschmidt/httprouter"
+	"AegisGate/internal/health"
+	"encoding/json"
 	"net/http"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
 )
 
+// Readiness statuses reported by the readiness endpoint
+const (
+	statusReady       = "ready"
+	statusUnavailable = "unavailable"
+)
+
+// readinessReport is the verbose response of the readiness endpoint
+type readinessReport struct {
+	Status   string          `json:"status"`
+	Serving  bool            `json:"serving"`
+	Services []serviceReport `json:"services"`
+}
+
+// serviceReport describes the readiness of a single service
+type serviceReport struct {
+	Name     string          `json:"name"`
+	Required bool            `json:"required"`
+	Healthy  bool            `json:"healthy"`
+	Targets  []health.Status `json:"targets"`
+}
+
 // handleNotFound returns a handler for 404 responses
 func (g *Gateway) handleNotFound() http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		g.reqLogger.LogRequest(r)
-		http.Error(w, "Not Found", http.StatusNotFound)
+		g.requestLogger().LogRequest(r)
+		httpError(w, r, "Not Found", http.StatusNotFound)
+	})
+}
+
+// methodPurge is the method of requests that remove the cached responses of their URL
+const methodPurge = "PURGE"
+
+// handlePurge removes the cached responses of the requested URL, for clients
+// with admin credentials
+func (g *Gateway) handlePurge(w http.ResponseWriter, r *http.Request, authorize func(r *http.Request) bool) {
+	g.requestLogger().LogRequest(r)
+
+	if !authorize(r) {
+		httpError(w, r, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	host, uri := strings.ToLower(r.Host), r.URL.RequestURI()
+	purged := g.cache.purge(purgeURL, func(item *cacheItem) bool {
+		return item.host == host && item.uri == uri
 	})
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]int{"purged": purged})
 }
 
-// handleHealthCheck handles the health check endpoint
-func (g *Gateway) handleHealthCheck(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
-	g.reqLogger.LogRequest(r)
+// handleLiveness handles the liveness endpoint, which succeeds as long as the process is running
+func (g *Gateway) handleLiveness(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	g.requestLogger().LogRequest(r)
+	w.WriteHeader(http.StatusOK)
+	_, err := w.Write([]byte("OK"))
+	if err != nil {
+		return
+	}
+}
+
+// handleReadiness handles the readiness endpoint, which fails until the
+// gateway is serving, while it shuts down, and while a required service has
+// no healthy target. With the verbose query parameter the status of every
+// service is returned as JSON.
+func (g *Gateway) handleReadiness(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	g.requestLogger().LogRequest(r)
+
+	report := g.readiness()
+	status := http.StatusOK
+	if report.Status != statusReady {
+		status = http.StatusServiceUnavailable
+	}
+
+	if isVerbose(r) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(report)
+		return
+	}
+
+	if status != http.StatusOK {
+		http.Error(w, "Service Unavailable", status)
+		return
+	}
 	w.WriteHeader(http.StatusOK)
 	_, err := w.Write([]byte("OK"))
 	if err != nil {
 		return
 	}
 }
+
+// readiness evaluates whether the gateway is ready to serve traffic
+func (g *Gateway) readiness() readinessReport {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	report := readinessReport{
+		Serving:  g.ready.Load(),
+		Services: make([]serviceReport, 0, len(g.config.Services)),
+	}
+
+	ready := report.Serving
+	for _, service := range g.config.Services {
+		target := g.targets[service.Name]
+		serviceReport := serviceReport{
+			Name:     service.Name,
+			Required: service.Required,
+			Healthy:  target.Healthy(),
+			Targets:  []health.Status{target.Status()},
+		}
+		if service.Required && !serviceReport.Healthy {
+			ready = false
+		}
+		report.Services = append(report.Services, serviceReport)
+	}
+
+	// TCP and UDP services are healthy while any of their targets is
+	for _, service := range g.config.TCPServices {
+		report.Services = append(report.Services, l4ServiceReport(service.Name, g.tcpServices[service.Name].state.Load().targets))
+	}
+	for _, service := range g.config.UDPServices {
+		report.Services = append(report.Services, l4ServiceReport(service.Name, g.udpServices[service.Name].state.Load().targets))
+	}
+
+	report.Status = statusUnavailable
+	if ready {
+		report.Status = statusReady
+	}
+
+	return report
+}
+
+// l4ServiceReport reports the health of a TCP or UDP service
+func l4ServiceReport(name string, targets map[string]*l4Target) serviceReport {
+	report := serviceReport{Name: name, Targets: l4Statuses(targets)}
+	for _, status := range report.Targets {
+		report.Healthy = report.Healthy || status.Healthy
+	}
+	return report
+}
+
+// isVerbose reports whether the verbose query parameter is set and not false
+func isVerbose(r *http.Request) bool {
+	query := r.URL.Query()
+	if !query.Has("verbose") {
+		return false
+	}
+	switch query.Get("verbose") {
+	case "0", "false":
+		return false
+	default:
+		return true
+	}
+}
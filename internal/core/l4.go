@@ -0,0 +1,517 @@
+package core
+
+import (
+	"AegisGate/internal/health"
+	"AegisGate/internal/logger"
+	"AegisGate/internal/metrics"
+	"AegisGate/pkg/types"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Metrics of the TCP and UDP services
+var (
+	l4ConnectionsTotal = metrics.NewCounter("aegisgate_l4_connections_total", "Connections and sessions of TCP and UDP services by result.", "service", "protocol", "result")
+	l4BytesTotal       = metrics.NewCounter("aegisgate_l4_bytes_total", "Bytes proxied by TCP and UDP services by direction.", "service", "protocol", "direction")
+)
+
+// Results of the connections and sessions of TCP and UDP services
+const (
+	l4Proxied  = "proxied"  // Connected to a target
+	l4Rejected = "rejected" // Refused by the connection or session limit
+	l4Failed   = "failed"   // No target was available or reachable
+)
+
+// sniReadTimeout limits the time a client may take to send its TLS ClientHello
+const sniReadTimeout = 10 * time.Second
+
+// halfCloseTimeout limits the time a TCP connection may go without traffic
+// once one side has finished writing
+const halfCloseTimeout = 30 * time.Second
+
+// errNoTarget is returned when every target of a service is unhealthy or drained
+var errNoTarget = errors.New("no healthy target available")
+
+// l4Target is a target of a TCP or UDP service
+type l4Target struct {
+	address string
+	health  *health.Target
+	active  atomic.Int64 // Open connections or sessions
+}
+
+// l4Targets returns the targets for the given addresses, keeping the targets
+// of the previous configuration so that their health and connection counts
+// survive reloads
+func l4Targets(service string, addresses []string, breaker types.CircuitBreakerConfig, previous, targets map[string]*l4Target) []*l4Target {
+	result := make([]*l4Target, 0, len(addresses))
+	for _, address := range addresses {
+		target, exists := targets[address]
+		if !exists {
+			target, exists = previous[address]
+			if !exists {
+				target = &l4Target{address: address, health: health.NewTarget(service, address, breaker)}
+			} else {
+				target.health.SetCircuitBreaker(breaker)
+			}
+			targets[address] = target
+		}
+		result = append(result, target)
+	}
+	return result
+}
+
+// balancer spreads the connections of a service over its targets
+type balancer struct {
+	strategy string
+	targets  []*l4Target
+	next     atomic.Uint64
+}
+
+// pick returns the next target that accepts connections, skipping the ones
+// already tried, or nil if there is none
+func (b *balancer) pick(tried map[*l4Target]bool) *l4Target {
+	start := int(b.next.Add(1)-1) % len(b.targets)
+	candidates := append(slices.Clone(b.targets[start:]), b.targets[:start]...)
+	if b.strategy == types.BalanceLeastConnections {
+		sort.SliceStable(candidates, func(i, j int) bool {
+			return candidates[i].active.Load() < candidates[j].active.Load()
+		})
+	}
+
+	for _, target := range candidates {
+		if !tried[target] && target.health.Allow() {
+			return target
+		}
+	}
+	return nil
+}
+
+// dial connects to a target, trying the others in turn when it fails
+func (b *balancer) dial(service, network string, timeout time.Duration, l *logger.Logger) (net.Conn, *l4Target, error) {
+	tried := make(map[*l4Target]bool, len(b.targets))
+	lastErr := errNoTarget
+	for {
+		target := b.pick(tried)
+		if target == nil {
+			return nil, nil, lastErr
+		}
+		tried[target] = true
+
+		conn, err := net.DialTimeout(network, target.address, timeout)
+		if err != nil {
+			target.health.ReportFailure(err)
+			l.Error("Service %s failed to connect to target %s: %v", service, target.address, err)
+			lastErr = err
+			continue
+		}
+		target.health.ReportSuccess()
+		return conn, target, nil
+	}
+}
+
+// l4Statuses returns the status of targets ordered by address
+func l4Statuses(targets map[string]*l4Target) []health.Status {
+	statuses := make([]health.Status, 0, len(targets))
+	for _, target := range targets {
+		statuses = append(statuses, target.health.Status())
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Address < statuses[j].Address
+	})
+	return statuses
+}
+
+// tcpService proxies the connections accepted on a TCP service listener
+type tcpService struct {
+	name     string
+	listener net.Listener
+	state    atomic.Pointer[tcpState]
+	logger   atomic.Pointer[logger.Logger]
+	conns    *connTracker // Client and target connections, closed when draining times out
+	active   atomic.Int64
+	wg       sync.WaitGroup
+	closing  atomic.Bool
+}
+
+// tcpState is the configuration of a TCP service, replaced on reload
+type tcpState struct {
+	config   types.TCPServiceConfig
+	targets  map[string]*l4Target
+	balancer *balancer // Nil when connections are only routed by server name
+	sni      []sniRoute
+}
+
+// sniRoute sends TLS connections for its server names to its own targets
+type sniRoute struct {
+	serverNames []string
+	balancer    *balancer
+}
+
+// newTCPService creates a TCP service that is not bound yet
+func newTCPService(name string) *tcpService {
+	return &tcpService{name: name, conns: newConnTracker()}
+}
+
+// tcpName returns the name of the listener of a TCP service
+func tcpName(service string) string {
+	return service + ".tcp"
+}
+
+// configure applies the configuration of the service to new connections
+func (s *tcpService) configure(config types.TCPServiceConfig, l *logger.Logger) {
+	var previous map[string]*l4Target
+	if current := s.state.Load(); current != nil {
+		previous = current.targets
+	}
+
+	state := &tcpState{config: config, targets: make(map[string]*l4Target)}
+	if len(config.Targets) > 0 {
+		state.balancer = &balancer{strategy: config.Balance, targets: l4Targets(config.Name, config.Targets, config.CircuitBreaker, previous, state.targets)}
+	}
+	for _, route := range config.SNI {
+		serverNames := make([]string, len(route.ServerNames))
+		for i, name := range route.ServerNames {
+			serverNames[i] = strings.ToLower(name)
+		}
+		state.sni = append(state.sni, sniRoute{
+			serverNames: serverNames,
+			balancer:    &balancer{strategy: config.Balance, targets: l4Targets(config.Name, route.Targets, config.CircuitBreaker, previous, state.targets)},
+		})
+	}
+
+	s.state.Store(state)
+	s.logger.Store(l)
+}
+
+// route returns the balancer for a TLS server name. Exact names take
+// precedence over wildcards, and connections matching no route go to the
+// default targets.
+func (s *tcpState) route(serverName string) *balancer {
+	name := strings.ToLower(strings.TrimSuffix(serverName, "."))
+	if name == "" {
+		return s.balancer
+	}
+
+	for _, route := range s.sni {
+		if slices.Contains(route.serverNames, name) {
+			return route.balancer
+		}
+	}
+	for _, route := range s.sni {
+		for _, pattern := range route.serverNames {
+			if suffix, ok := strings.CutPrefix(pattern, "*"); ok && len(name) > len(suffix) && strings.HasSuffix(name, suffix) {
+				return route.balancer
+			}
+		}
+	}
+	return s.balancer
+}
+
+// serve accepts connections until the service is shut down
+func (s *tcpService) serve() error {
+	listener := s.listener
+	if config := s.state.Load().config.ProxyProtocol; config.Enabled {
+		listener = newProxyProtocolListener(listener, config, s.logger.Load())
+		defer listener.Close()
+	}
+
+	var backoff acceptBackoff
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if s.closing.Load() {
+				return http.ErrServerClosed
+			}
+			if errors.Is(err, net.ErrClosed) {
+				return err
+			}
+			// Other errors pass, so that one service cannot take the gateway down
+			delay := backoff.next()
+			s.logger.Load().Error("TCP service %s: accept error: %v, retrying in %v", s.name, err, delay)
+			time.Sleep(delay)
+			continue
+		}
+		backoff.reset()
+
+		state := s.state.Load()
+		if limit := state.config.MaxConnections; limit > 0 && s.active.Load() >= int64(limit) {
+			s.logger.Load().Debug("TCP service %s rejected connection from %s: limit of %d connections reached", s.name, conn.RemoteAddr(), limit)
+			l4ConnectionsTotal.Inc(s.name, "tcp", l4Rejected)
+			_ = conn.Close()
+			continue
+		}
+
+		s.active.Add(1)
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer s.active.Add(-1)
+			s.handle(conn, state)
+		}()
+	}
+}
+
+// handle proxies a client connection to a target until either side closes it
+func (s *tcpService) handle(conn net.Conn, state *tcpState) {
+	defer conn.Close()
+	l := s.logger.Load()
+
+	b := state.balancer
+	var hello []byte
+	if len(state.sni) > 0 {
+		serverName, data, err := readServerName(conn, sniReadTimeout)
+		if err != nil {
+			l.Debug("TCP service %s: no TLS server name from %s: %v", s.name, conn.RemoteAddr(), err)
+		}
+		hello = data
+		b = state.route(serverName)
+		if b == nil {
+			l.Debug("TCP service %s: no route for server name '%s' from %s", s.name, serverName, conn.RemoteAddr())
+			l4ConnectionsTotal.Inc(s.name, "tcp", l4Failed)
+			return
+		}
+	}
+
+	upstream, target, err := b.dial(s.name, "tcp", state.config.ConnectTimeout.Std(), l)
+	if err != nil {
+		l.Error("TCP service %s: failed to proxy connection from %s: %v", s.name, conn.RemoteAddr(), err)
+		l4ConnectionsTotal.Inc(s.name, "tcp", l4Failed)
+		return
+	}
+	upstream = s.conns.Track(upstream)
+	defer upstream.Close()
+
+	target.active.Add(1)
+	defer target.active.Add(-1)
+	l4ConnectionsTotal.Inc(s.name, "tcp", l4Proxied)
+	l.Debug("TCP service %s: proxying %s to %s", s.name, conn.RemoteAddr(), target.address)
+
+	if version := state.config.SendProxyProtocol; version != "" {
+		if _, err := upstream.Write(proxyHeader(version, conn.RemoteAddr(), conn.LocalAddr())); err != nil {
+			l.Debug("TCP service %s: failed to write to %s: %v", s.name, target.address, err)
+			return
+		}
+	}
+
+	// Replay the ClientHello read to find the server name
+	if len(hello) > 0 {
+		if _, err := upstream.Write(hello); err != nil {
+			l.Debug("TCP service %s: failed to write to %s: %v", s.name, target.address, err)
+			return
+		}
+		l4BytesTotal.Add(float64(len(hello)), s.name, "tcp", "upstream")
+	}
+
+	client, backend := conn, upstream
+	if idle := state.config.IdleTimeout.Std(); idle > 0 {
+		timer := time.AfterFunc(idle, func() {
+			_ = conn.Close()
+			_ = upstream.Close()
+		})
+		client = &idleConn{Conn: conn, timeout: idle, timer: timer}
+		backend = &idleConn{Conn: upstream, timeout: idle, timer: timer}
+	}
+	s.pipe(client, backend)
+}
+
+// pipe copies data in both directions until both sides have finished writing.
+// Once one side has finished, the other is closed after halfCloseTimeout
+// without traffic, so a peer that never closes cannot hold the connection.
+func (s *tcpService) pipe(client, upstream net.Conn) {
+	var wg sync.WaitGroup
+	var halfClosed atomic.Bool
+	copyConn := func(dst, src net.Conn, direction string) {
+		defer wg.Done()
+		n, _ := io.Copy(dst, &halfCloseReader{conn: src, halfClosed: &halfClosed})
+		l4BytesTotal.Add(float64(n), s.name, "tcp", direction)
+		closeWrite(dst)
+
+		// Interrupt a read of the other direction that is already waiting
+		if halfClosed.CompareAndSwap(false, true) {
+			_ = dst.SetReadDeadline(time.Now().Add(halfCloseTimeout))
+		}
+	}
+
+	wg.Add(2)
+	go copyConn(upstream, client, "upstream")
+	go copyConn(client, upstream, "downstream")
+	wg.Wait()
+}
+
+// halfCloseReader reads from a connection, extending its read deadline before
+// every read once the other direction of the connection has finished
+type halfCloseReader struct {
+	conn       net.Conn
+	halfClosed *atomic.Bool
+}
+
+// Read reads from the connection
+func (r *halfCloseReader) Read(p []byte) (int, error) {
+	if r.halfClosed.Load() {
+		_ = r.conn.SetReadDeadline(time.Now().Add(halfCloseTimeout))
+	}
+	return r.conn.Read(p)
+}
+
+// closeWrite shuts down the writing side of a connection, or closes it when
+// it cannot be half-closed
+func closeWrite(conn net.Conn) {
+	for {
+		switch c := conn.(type) {
+		case *idleConn:
+			conn = c.Conn
+		case *trackedConn:
+			conn = c.Conn
+		case *proxyConn:
+			conn = c.Conn
+		case interface{ CloseWrite() error }:
+			_ = c.CloseWrite()
+			return
+		default:
+			_ = conn.Close()
+			return
+		}
+	}
+}
+
+// shutdown stops accepting connections and waits for open ones to finish
+// until ctx is done, closing them afterwards
+func (s *tcpService) shutdown(ctx context.Context) error {
+	s.closing.Store(true)
+	_ = s.listener.Close()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		if closed := s.conns.CloseAll(); closed > 0 {
+			s.logger.Load().Info("Closed %d remaining connections of TCP service %s", closed, s.name)
+		}
+		return ctx.Err()
+	}
+}
+
+// close stops the service immediately, closing all connections
+func (s *tcpService) close() error {
+	s.closing.Store(true)
+	err := s.listener.Close()
+	s.conns.CloseAll()
+	return err
+}
+
+// errClientHelloRead stops a TLS handshake once the ClientHello has been read
+var errClientHelloRead = errors.New("client hello read")
+
+// readServerName reads the TLS ClientHello of a connection and returns the
+// server name it asks for, along with the bytes read so that they can be
+// passed on to the target
+func readServerName(conn net.Conn, timeout time.Duration) (string, []byte, error) {
+	if err := conn.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		return "", nil, err
+	}
+	defer conn.SetReadDeadline(time.Time{})
+
+	var data bytes.Buffer
+	var serverName string
+	err := tls.Server(&helloConn{Conn: conn, reader: io.TeeReader(conn, &data)}, &tls.Config{
+		GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			serverName = hello.ServerName
+			return nil, errClientHelloRead
+		},
+	}).Handshake()
+	if !errors.Is(err, errClientHelloRead) {
+		return "", data.Bytes(), err
+	}
+	return serverName, data.Bytes(), nil
+}
+
+// helloConn reads from a connection without ever writing to it, so that a
+// TLS handshake can parse the ClientHello without answering it
+type helloConn struct {
+	net.Conn
+	reader io.Reader
+}
+
+// Read reads from the connection through the reader
+func (c *helloConn) Read(p []byte) (int, error) {
+	return c.reader.Read(p)
+}
+
+// Write discards the handshake messages of the server
+func (c *helloConn) Write([]byte) (int, error) {
+	return 0, io.ErrClosedPipe
+}
+
+// configureL4Services applies the configuration of the TCP and UDP services,
+// creating the ones that are not bound yet. The caller must hold the write
+// lock or have exclusive access to the gateway.
+func (g *Gateway) configureL4Services(config *types.Config, l *logger.Logger) {
+	tcpServices := make(map[string]*tcpService, len(config.TCPServices))
+	for _, service := range config.TCPServices {
+		s, exists := g.tcpServices[service.Name]
+		if !exists {
+			s = newTCPService(service.Name)
+		}
+		s.configure(service, l)
+		tcpServices[service.Name] = s
+	}
+
+	udpServices := make(map[string]*udpService, len(config.UDPServices))
+	for _, service := range config.UDPServices {
+		s, exists := g.udpServices[service.Name]
+		if !exists {
+			s = newUDPService(service.Name)
+		}
+		s.configure(service, l)
+		udpServices[service.Name] = s
+	}
+
+	g.tcpServices = tcpServices
+	g.udpServices = udpServices
+}
+
+// checkL4Services verifies that a configuration keeps the bound TCP and UDP
+// services on the same addresses, since they are bound once
+func checkL4Services(config *types.Config, tcpServices map[string]*tcpService, udpServices map[string]*udpService) error {
+	if len(config.TCPServices) != len(tcpServices) || len(config.UDPServices) != len(udpServices) {
+		return fmt.Errorf("tcp or udp services changed, restart or upgrade the gateway to apply")
+	}
+
+	for _, service := range config.TCPServices {
+		s, exists := tcpServices[service.Name]
+		if !exists {
+			return fmt.Errorf("tcp or udp services changed, restart or upgrade the gateway to apply")
+		}
+		current := s.state.Load().config
+		if current.Listen != service.Listen || !reflect.DeepEqual(current.ProxyProtocol, service.ProxyProtocol) {
+			return fmt.Errorf("tcp service %s changed address or proxy_protocol, restart or upgrade the gateway to apply", service.Name)
+		}
+	}
+	for _, service := range config.UDPServices {
+		s, exists := udpServices[service.Name]
+		if !exists || s.state.Load().config.Listen != service.Listen {
+			return fmt.Errorf("udp service %s changed address, restart or upgrade the gateway to apply", service.Name)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,59 @@
+package core
+
+import (
+	"AegisGate/pkg/types"
+	"errors"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// checkHeaders reports whether the header fields of a request are within the
+// count and size limits of the server
+func checkHeaders(r *http.Request, server types.ServerConfig) bool {
+	count := 0
+	for name, values := range r.Header {
+		count += len(values)
+		if server.MaxHeaderSize <= 0 {
+			continue
+		}
+		for _, value := range values {
+			if types.ByteSize(len(name)+len(value)) > server.MaxHeaderSize {
+				return false
+			}
+		}
+	}
+	return server.MaxHeaderCount <= 0 || count <= server.MaxHeaderCount
+}
+
+// acceptsContentType reports whether the body of a request has one of the
+// allowed media types. Requests without a body are always accepted.
+func acceptsContentType(r *http.Request, allowed []string) bool {
+	if len(allowed) == 0 || r.ContentLength == 0 {
+		return true
+	}
+
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+
+	for _, contentType := range allowed {
+		contentType = strings.ToLower(contentType)
+		if prefix, wildcard := strings.CutSuffix(contentType, "/*"); wildcard {
+			if prefix == "*" || strings.HasPrefix(mediaType, prefix+"/") {
+				return true
+			}
+		} else if mediaType == contentType {
+			return true
+		}
+	}
+	return false
+}
+
+// isBodyTooLarge reports whether err was caused by a request body exceeding
+// the maximum size of its route
+func isBodyTooLarge(err error) bool {
+	var maxBytesErr *http.MaxBytesError
+	return errors.As(err, &maxBytesErr)
+}
@@ -0,0 +1,372 @@
+package core
+
+import (
+	"AegisGate/internal/logger"
+	"AegisGate/pkg/types"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/user"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// ListenFunc creates the listener with the given name on a network address
+type ListenFunc func(name, network, address string) (net.Listener, error)
+
+// defaultListen creates a new listener, ignoring its name
+func defaultListen(_, network, address string) (net.Listener, error) {
+	return net.Listen(network, address)
+}
+
+// ListenPacketFunc creates the packet listener with the given name on a network address
+type ListenPacketFunc func(name, network, address string) (net.PacketConn, error)
+
+// defaultListenPacket creates a new packet listener, ignoring its name
+func defaultListenPacket(_, network, address string) (net.PacketConn, error) {
+	return net.ListenPacket(network, address)
+}
+
+// bind creates the listener of a listener configuration. Unix sockets left
+// behind by a process that did not exit cleanly are replaced, and the socket
+// file gets the configured permissions.
+func (g *Gateway) bind(listener types.ListenerConfig) (net.Listener, error) {
+	network, address := listener.Network()
+	ln, err := g.listen(listener.Name, network, address)
+	if network != "unix" {
+		return ln, err
+	}
+
+	if errors.Is(err, syscall.EADDRINUSE) && removeStaleSocket(address) {
+		g.logger.Info("Removed stale socket %s of listener %s", address, listener.Name)
+		ln, err = g.listen(listener.Name, network, address)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := setSocketPermissions(address, listener.Socket); err != nil {
+		_ = ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
+
+// removeStaleSocket removes a socket file that no process is listening on
+// and reports whether it did
+func removeStaleSocket(path string) bool {
+	if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+		_ = conn.Close()
+		return false
+	}
+
+	info, err := os.Lstat(path)
+	if err != nil || info.Mode()&os.ModeSocket == 0 {
+		return false
+	}
+	return os.Remove(path) == nil
+}
+
+// setSocketPermissions sets the mode and owner of a socket file
+func setSocketPermissions(path string, config types.UnixSocketConfig) error {
+	if config.Mode != "" {
+		mode, err := strconv.ParseUint(config.Mode, 8, 32)
+		if err != nil {
+			return fmt.Errorf("invalid socket mode '%s': %w", config.Mode, err)
+		}
+		if err := os.Chmod(path, os.FileMode(mode)); err != nil {
+			return fmt.Errorf("failed to set mode of %s: %w", path, err)
+		}
+	}
+
+	if config.Owner == "" && config.Group == "" {
+		return nil
+	}
+
+	uid, gid := -1, -1
+	if config.Owner != "" {
+		id := config.Owner
+		if u, err := user.Lookup(config.Owner); err == nil {
+			id = u.Uid
+		}
+		n, err := strconv.Atoi(id)
+		if err != nil {
+			return fmt.Errorf("unknown socket owner '%s'", config.Owner)
+		}
+		uid = n
+	}
+	if config.Group != "" {
+		id := config.Group
+		if g, err := user.LookupGroup(config.Group); err == nil {
+			id = g.Gid
+		}
+		n, err := strconv.Atoi(id)
+		if err != nil {
+			return fmt.Errorf("unknown socket group '%s'", config.Group)
+		}
+		gid = n
+	}
+
+	if err := os.Chown(path, uid, gid); err != nil {
+		return fmt.Errorf("failed to set owner of %s: %w", path, err)
+	}
+	return nil
+}
+
+// connTracker keeps track of open connections, including hijacked ones that
+// the HTTP server no longer manages, so that they can be closed on shutdown
+type connTracker struct {
+	mu    sync.Mutex
+	conns map[*trackedConn]struct{}
+}
+
+// newConnTracker creates a new connTracker
+func newConnTracker() *connTracker {
+	return &connTracker{
+		conns: make(map[*trackedConn]struct{}),
+	}
+}
+
+// Listener wraps a listener so that all accepted connections are tracked
+func (t *connTracker) Listener(l net.Listener) net.Listener {
+	return &trackedListener{Listener: l, tracker: t}
+}
+
+// Track starts tracking a connection, such as one dialed to a target
+func (t *connTracker) Track(conn net.Conn) net.Conn {
+	tc := &trackedConn{Conn: conn, tracker: t}
+	t.mu.Lock()
+	t.conns[tc] = struct{}{}
+	t.mu.Unlock()
+	return tc
+}
+
+// CloseAll closes every open connection and returns how many were closed
+func (t *connTracker) CloseAll() int {
+	t.mu.Lock()
+	conns := make([]*trackedConn, 0, len(t.conns))
+	for conn := range t.conns {
+		conns = append(conns, conn)
+	}
+	t.mu.Unlock()
+
+	for _, conn := range conns {
+		_ = conn.Close()
+	}
+	return len(conns)
+}
+
+// trackedListener registers accepted connections with a connTracker
+type trackedListener struct {
+	net.Listener
+	tracker *connTracker
+}
+
+// Accept waits for and returns the next tracked connection
+func (l *trackedListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return l.tracker.Track(conn), nil
+}
+
+// trackedConn removes itself from its connTracker when closed
+type trackedConn struct {
+	net.Conn
+	tracker *connTracker
+	once    sync.Once
+}
+
+// Close closes the connection and stops tracking it
+func (c *trackedConn) Close() error {
+	c.once.Do(func() {
+		c.tracker.mu.Lock()
+		delete(c.tracker.conns, c)
+		c.tracker.mu.Unlock()
+	})
+	return c.Conn.Close()
+}
+
+// connLimiter limits the number of concurrent connections, in total and per
+// client IP, across all listeners sharing it
+type connLimiter struct {
+	mu       sync.Mutex
+	cond     *sync.Cond
+	max      int
+	maxPerIP int
+	active   int
+	perIP    map[string]int
+	logger   *logger.Logger
+}
+
+// newConnLimiter creates a new connLimiter
+func newConnLimiter(config types.ConnectionsConfig, l *logger.Logger) *connLimiter {
+	cl := &connLimiter{
+		max:      config.Max,
+		maxPerIP: config.MaxPerIP,
+		perIP:    make(map[string]int),
+		logger:   l,
+	}
+	cl.cond = sync.NewCond(&cl.mu)
+	return cl
+}
+
+// SetLimits updates the limits. Connections above a lowered limit are kept
+// open, but no new ones are accepted until the count drops below it.
+func (cl *connLimiter) SetLimits(config types.ConnectionsConfig, l *logger.Logger) {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	cl.max = config.Max
+	cl.maxPerIP = config.MaxPerIP
+	cl.logger = l
+	cl.cond.Broadcast()
+}
+
+// Listener wraps a listener so that accepted connections count towards the limits
+func (cl *connLimiter) Listener(l net.Listener) net.Listener {
+	return &limitedListener{Listener: l, limiter: cl}
+}
+
+// reserve waits until a connection may be accepted without exceeding the
+// total limit, or until the listener is closed
+func (cl *connLimiter) reserve(closed *atomic.Bool) bool {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	for cl.max > 0 && cl.active >= cl.max && !closed.Load() {
+		cl.cond.Wait()
+	}
+	if closed.Load() {
+		return false
+	}
+
+	cl.active++
+	return true
+}
+
+// admit counts a connection from a client IP, reporting false if the client
+// already has the maximum number of connections open
+func (cl *connLimiter) admit(ip string) bool {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	if cl.maxPerIP > 0 && cl.perIP[ip] >= cl.maxPerIP {
+		cl.logger.Debug("Rejected connection from %s: too many connections from this client", ip)
+		return false
+	}
+
+	cl.perIP[ip]++
+	return true
+}
+
+// release frees the slots taken by a connection, with an empty ip if the
+// connection was never admitted
+func (cl *connLimiter) release(ip string) {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	cl.active--
+	if ip != "" {
+		cl.perIP[ip]--
+		if cl.perIP[ip] <= 0 {
+			delete(cl.perIP, ip)
+		}
+	}
+	cl.cond.Signal()
+}
+
+// limitedListener enforces the limits of a connLimiter on accepted connections
+type limitedListener struct {
+	net.Listener
+	limiter *connLimiter
+	closed  atomic.Bool
+}
+
+// Accept waits until the connection limits allow a new connection and returns
+// it. Connections from clients that are over their limit are closed right away.
+func (l *limitedListener) Accept() (net.Conn, error) {
+	for {
+		if !l.limiter.reserve(&l.closed) {
+			return nil, net.ErrClosed
+		}
+
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			l.limiter.release("")
+			return nil, err
+		}
+
+		ip := remoteIP(conn)
+		if !l.limiter.admit(ip) {
+			l.limiter.release("")
+			_ = conn.Close()
+			continue
+		}
+
+		return &limitedConn{Conn: conn, limiter: l.limiter, ip: ip}, nil
+	}
+}
+
+// Close closes the listener and wakes up a pending Accept
+func (l *limitedListener) Close() error {
+	l.closed.Store(true)
+	l.limiter.mu.Lock()
+	l.limiter.cond.Broadcast()
+	l.limiter.mu.Unlock()
+	return l.Listener.Close()
+}
+
+// limitedConn frees its slots in the connLimiter when closed
+type limitedConn struct {
+	net.Conn
+	limiter *connLimiter
+	ip      string
+	once    sync.Once
+}
+
+// Close closes the connection and frees its slots
+func (c *limitedConn) Close() error {
+	c.once.Do(func() {
+		c.limiter.release(c.ip)
+	})
+	return c.Conn.Close()
+}
+
+// remoteIP returns the IP address of the client of a connection
+func remoteIP(conn net.Conn) string {
+	addr := conn.RemoteAddr().String()
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
+
+// Delays between retries of a failing accept, the same as those of http.Server
+const (
+	minAcceptDelay = 5 * time.Millisecond
+	maxAcceptDelay = time.Second
+)
+
+// acceptBackoff spaces out retries of accepts that fail for reasons that
+// pass, such as the process running out of file descriptors
+type acceptBackoff struct {
+	delay time.Duration
+}
+
+// next returns the delay before the next retry, doubling it every time
+func (b *acceptBackoff) next() time.Duration {
+	b.delay = min(max(2*b.delay, minAcceptDelay), maxAcceptDelay)
+	return b.delay
+}
+
+// reset starts over from the shortest delay after a successful accept
+func (b *acceptBackoff) reset() {
+	b.delay = 0
+}
@@ -1,16 +1,28 @@
 package core
 
 import (
+	"AegisGate/internal/health"
 	"AegisGate/internal/logger"
+	"AegisGate/internal/metrics"
 	"AegisGate/pkg/types"
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
+	"slices"
+	"strconv"
 	"sync"
 	"time"
 )
 
+// Request metrics of the proxied services
+var (
+	requestsTotal     = metrics.NewCounter("aegisgate_requests_total", "Requests proxied to services by HTTP status code.", "service", "code")
+	grpcRequestsTotal = metrics.NewCounter("aegisgate_grpc_requests_total", "gRPC calls proxied to services by gRPC status code.", "service", "grpc_status")
+)
+
 // ProxyManager manages reverse proxies for services
 type ProxyManager struct {
 	proxies map[string]*ServiceProxy
@@ -22,38 +34,54 @@ type ProxyManager struct {
 type ServiceProxy struct {
 	name      string
 	targetURL *url.URL
-	proxy     *httputil.ReverseProxy
+	proxies   map[time.Duration]*httputil.ReverseProxy // By flush interval
 	config    types.ServiceConfig
+	target    *health.Target
 	logger    *logger.RequestLogger
 }
 
 // NewProxyManager creates a new ProxyManager instance
-func NewProxyManager(debug bool) *ProxyManager {
+func NewProxyManager(l *logger.Logger) *ProxyManager {
 	return &ProxyManager{
 		proxies: make(map[string]*ServiceProxy),
-		logger:  logger.New(debug),
+		logger:  l,
 	}
 }
 
-// AddService creates and adds a new proxy for a service
-func (pm *ProxyManager) AddService(service types.ServiceConfig) error {
+// AddService creates and adds a new proxy for a service whose health is tracked
+// by target and whose requests are sent through transport
+func (pm *ProxyManager) AddService(service types.ServiceConfig, target *health.Target, transport http.RoundTripper) error {
 	targetURL, err := url.Parse(service.TargetURL)
 	if err != nil {
 		return fmt.Errorf("invalid target URL for service %s: %w", service.Name, err)
 	}
 
-	proxy := httputil.NewSingleHostReverseProxy(targetURL)
 	reqLogger := logger.NewRequestLogger(pm.logger, service.Name)
 
 	// Configure proxy settings
-	proxy.ModifyResponse = modifyResponse
-	proxy.ErrorHandler = createErrorHandler(reqLogger)
+	newProxy := func(flushInterval time.Duration) *httputil.ReverseProxy {
+		proxy := httputil.NewSingleHostReverseProxy(upstreamURL(targetURL))
+		proxy.Transport = transport
+		proxy.FlushInterval = flushInterval
+		proxy.ModifyResponse = createResponseModifier(target, service.CircuitBreaker.FailureStatuses)
+		proxy.ErrorHandler = createErrorHandler(reqLogger, target)
+		return proxy
+	}
+
+	// Routes share a proxy unless they flush at a different interval
+	proxies := map[time.Duration]*httputil.ReverseProxy{0: newProxy(0)}
+	for _, route := range service.Routes {
+		if _, exists := proxies[route.FlushInterval.Std()]; !exists {
+			proxies[route.FlushInterval.Std()] = newProxy(route.FlushInterval.Std())
+		}
+	}
 
 	serviceProxy := &ServiceProxy{
 		name:      service.Name,
 		targetURL: targetURL,
-		proxy:     proxy,
+		proxies:   proxies,
 		config:    service,
+		target:    target,
 		logger:    reqLogger,
 	}
 
@@ -64,18 +92,26 @@ func (pm *ProxyManager) AddService(service types.ServiceConfig) error {
 	return nil
 }
 
-// ServeHTTP handles the proxying of requests
-func (sp *ServiceProxy) ServeHTTP(w http.ResponseWriter, r *http.Request, stripPath bool) {
+// ServeHTTP handles the proxying of requests matched by a route
+func (sp *ServiceProxy) ServeHTTP(w http.ResponseWriter, r *http.Request, route types.Route) {
 	start := time.Now()
 
 	// Log incoming request
 	sp.logger.LogRequest(r)
 
-	// Clone the request to modify it safely
-	outReq := r.Clone(r.Context())
+	// Reject the request if the target is drained or its circuit is open
+	if !sp.target.Allow() {
+		sp.logger.LogError("Target %s is unavailable", sp.targetURL)
+		httpError(w, r, "Service Unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	// Clone the request to modify it safely, keeping the client address for
+	// PROXY protocol headers sent to the target
+	outReq := r.Clone(context.WithValue(r.Context(), clientAddrKey{}, r.RemoteAddr))
 
 	// Strip path if configured
-	if stripPath {
+	if route.StripPath {
 		originalPath := outReq.URL.Path
 		outReq.URL.Path = stripBasePath(outReq.URL.Path, sp.config.BasePath)
 		sp.logger.LogPathStripped(originalPath, outReq.URL.Path)
@@ -83,24 +119,58 @@ func (sp *ServiceProxy) ServeHTTP(w http.ResponseWriter, r *http.Request, stripP
 
 	// Add custom headers
 	outReq.Header.Set("X-Forwarded-Host", r.Host)
-	outReq.Header.Set("X-Origin-Host", sp.targetURL.Host)
-	outReq.Host = sp.targetURL.Host
+	// Targets behind a Unix socket have no host name, so they receive the one the client asked for
+	if sp.targetURL.Scheme != types.UnixScheme {
+		outReq.Header.Set("X-Origin-Host", sp.targetURL.Host)
+		outReq.Host = sp.targetURL.Host
+	}
 
 	// Create a custom response writer to capture status code and size
 	rw := logger.NewResponseWriter(w)
 
-	// Forward the request to the target service
-	sp.proxy.ServeHTTP(rw, outReq)
+	// Log and count the completed request, also when an interrupted stream aborts the handler
+	defer func() {
+		sp.logger.LogCompleted(r, rw, sp.targetURL.String()+outReq.URL.Path, start)
+		requestsTotal.Inc(sp.name, strconv.Itoa(rw.StatusCode()))
+		if status := rw.GRPCStatus(); status != "" {
+			grpcRequestsTotal.Inc(sp.name, status)
+		}
+	}()
 
-	// Log the completed request
-	sp.logger.LogCompleted(r, rw, sp.targetURL.String()+outReq.URL.Path, start)
+	// Forward the request to the target service
+	proxy, exists := sp.proxies[route.FlushInterval.Std()]
+	if !exists {
+		proxy = sp.proxies[0]
+	}
+	proxy.ServeHTTP(rw, outReq)
 }
 
 // createErrorHandler creates an error handler with logging
-func createErrorHandler(reqLogger *logger.RequestLogger) func(http.ResponseWriter, *http.Request, error) {
+func createErrorHandler(reqLogger *logger.RequestLogger, target *health.Target) func(http.ResponseWriter, *http.Request, error) {
 	return func(w http.ResponseWriter, r *http.Request, err error) {
+		// Report the timeout rather than the cancellation it caused
+		if cause := context.Cause(r.Context()); cause != nil && !errors.Is(cause, context.Canceled) && !errors.Is(err, cause) {
+			err = fmt.Errorf("%w: %w", cause, err)
+		}
 		reqLogger.LogError("Proxy error: %v", err)
-		http.Error(w, "Bad Gateway", http.StatusBadGateway)
+
+		// The client sent a larger body than the route accepts
+		if isBodyTooLarge(err) {
+			httpError(w, r, "Request Entity Too Large", http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		if isTimeout(r, err) {
+			target.ReportFailure(err)
+			httpError(w, r, "Gateway Timeout", http.StatusGatewayTimeout)
+			return
+		}
+
+		// A client that went away says nothing about the health of the target
+		if !errors.Is(err, context.Canceled) {
+			target.ReportFailure(err)
+		}
+		httpError(w, r, "Bad Gateway", http.StatusBadGateway)
 	}
 }
 
@@ -117,11 +187,33 @@ func (pm *ProxyManager) GetProxy(serviceName string) (*ServiceProxy, error) {
 	return proxy, nil
 }
 
-// modifyResponse modifies the response from the backend service
-func modifyResponse(resp *http.Response) error {
-	// Add custom response headers
-	resp.Header.Set("X-Proxy", "AegisGate")
-	return nil
+// createResponseModifier creates a function that modifies the response from the backend
+// service and records its outcome on the target, counting failureStatuses as failures
+func createResponseModifier(target *health.Target, failureStatuses []int) func(*http.Response) error {
+	return func(resp *http.Response) error {
+		if slices.Contains(failureStatuses, resp.StatusCode) {
+			target.ReportFailure(fmt.Errorf("upstream responded with %s", resp.Status))
+		} else {
+			target.ReportSuccess()
+		}
+
+		// Streams are bounded by the idle stream timeout rather than the request timeout
+		applyStreamingTimeouts(resp)
+
+		// Add custom response headers
+		resp.Header.Set("X-Proxy", "AegisGate")
+		return nil
+	}
+}
+
+// upstreamURL returns the URL requests to a target are sent to. Requests to
+// Unix sockets are plain HTTP requests on connections the transport dials to
+// the socket.
+func upstreamURL(targetURL *url.URL) *url.URL {
+	if targetURL.Scheme == types.UnixScheme {
+		return &url.URL{Scheme: "http", Host: "localhost"}
+	}
+	return targetURL
 }
 
 // stripBasePath removes the base path from the request path
@@ -0,0 +1,398 @@
+package core
+
+import (
+	"AegisGate/internal/logger"
+	"AegisGate/pkg/types"
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// proxyProtocolV2Signature starts every binary PROXY protocol header
+var proxyProtocolV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// maxProxyProtocolV1Length is the maximum length of a text header, including CRLF
+const maxProxyProtocolV1Length = 107
+
+// clientAddrKey is the context key of the client address of a proxied request
+type clientAddrKey struct{}
+
+// proxyProtocolListener reads the PROXY protocol header of connections from
+// trusted peers before handing them out, so that their remote address is the
+// one of the client behind the load balancer. Headers are read concurrently
+// so that a slow peer does not hold up other connections.
+type proxyProtocolListener struct {
+	net.Listener
+	trusted []netip.Prefix
+	timeout time.Duration
+	logger  *logger.Logger
+	conns   chan net.Conn
+	errs    chan error
+	done    chan struct{}
+	once    sync.Once
+}
+
+// newProxyProtocolListener wraps a listener to read PROXY protocol headers
+func newProxyProtocolListener(l net.Listener, config types.ProxyProtocolConfig, log *logger.Logger) *proxyProtocolListener {
+	trusted := make([]netip.Prefix, 0, len(config.TrustedCIDRs))
+	for _, cidr := range config.TrustedCIDRs {
+		if prefix, err := netip.ParsePrefix(cidr); err == nil {
+			trusted = append(trusted, prefix.Masked())
+		}
+	}
+
+	pl := &proxyProtocolListener{
+		Listener: l,
+		trusted:  trusted,
+		timeout:  config.HeaderTimeout.Std(),
+		logger:   log,
+		conns:    make(chan net.Conn),
+		errs:     make(chan error),
+		done:     make(chan struct{}),
+	}
+	go pl.acceptLoop()
+	return pl
+}
+
+// Accept waits for and returns the next connection whose header has been read
+func (l *proxyProtocolListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case err := <-l.errs:
+		return nil, err
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close closes the listener, unblocking Accept
+func (l *proxyProtocolListener) Close() error {
+	l.once.Do(func() {
+		close(l.done)
+	})
+	return l.Listener.Close()
+}
+
+// acceptLoop accepts connections and reads the headers of trusted peers.
+// Accept errors other than a closed listener are retried with a backoff, since
+// nothing accepts connections for Accept once the loop has ended.
+func (l *proxyProtocolListener) acceptLoop() {
+	var backoff acceptBackoff
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				select {
+				case l.errs <- err:
+				case <-l.done:
+				}
+				return
+			}
+
+			delay := backoff.next()
+			l.logger.Error("Accept error: %v, retrying in %v", err, delay)
+			select {
+			case <-time.After(delay):
+				continue
+			case <-l.done:
+				return
+			}
+		}
+		backoff.reset()
+
+		if !l.isTrusted(conn.RemoteAddr()) {
+			l.deliver(conn)
+			continue
+		}
+
+		go func() {
+			pc, err := readProxyHeader(conn, l.timeout)
+			if err != nil {
+				l.logger.Info("Closing connection from %s: invalid PROXY protocol header: %v", conn.RemoteAddr(), err)
+				_ = conn.Close()
+				return
+			}
+			l.deliver(pc)
+		}()
+	}
+}
+
+// deliver hands a connection to Accept, closing it if the listener is closed
+func (l *proxyProtocolListener) deliver(conn net.Conn) {
+	select {
+	case l.conns <- conn:
+	case <-l.done:
+		_ = conn.Close()
+	}
+}
+
+// isTrusted reports whether a peer may send PROXY protocol headers
+func (l *proxyProtocolListener) isTrusted(addr net.Addr) bool {
+	addrPort, err := netip.ParseAddrPort(addr.String())
+	if err != nil {
+		return false
+	}
+	ip := addrPort.Addr().Unmap()
+	for _, prefix := range l.trusted {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// proxyConn is a connection whose addresses were taken from a PROXY protocol header
+type proxyConn struct {
+	net.Conn
+	reader *bufio.Reader
+	remote net.Addr
+	local  net.Addr
+}
+
+// Read reads from the connection, starting with the data buffered after the header
+func (c *proxyConn) Read(p []byte) (int, error) {
+	return c.reader.Read(p)
+}
+
+// RemoteAddr returns the address of the client
+func (c *proxyConn) RemoteAddr() net.Addr {
+	return c.remote
+}
+
+// LocalAddr returns the address the client connected to
+func (c *proxyConn) LocalAddr() net.Addr {
+	return c.local
+}
+
+// readProxyHeader reads the PROXY protocol header at the start of a
+// connection. Headers of health checks (LOCAL, UNKNOWN) keep the addresses of
+// the connection.
+func readProxyHeader(conn net.Conn, timeout time.Duration) (net.Conn, error) {
+	if timeout > 0 {
+		if err := conn.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+			return nil, err
+		}
+		defer conn.SetReadDeadline(time.Time{})
+	}
+
+	pc := &proxyConn{
+		Conn:   conn,
+		reader: bufio.NewReader(conn),
+		remote: conn.RemoteAddr(),
+		local:  conn.LocalAddr(),
+	}
+
+	// The shortest valid header, "PROXY UNKNOWN\r\n", is longer than the signature
+	start, err := pc.reader.Peek(len(proxyProtocolV2Signature))
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case bytes.Equal(start, proxyProtocolV2Signature):
+		err = pc.readV2()
+	case bytes.HasPrefix(start, []byte("PROXY ")):
+		err = pc.readV1()
+	default:
+		err = fmt.Errorf("no PROXY protocol header")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return pc, nil
+}
+
+// readV1 reads a text header such as "PROXY TCP4 192.0.2.1 192.0.2.2 56324 443"
+func (c *proxyConn) readV1() error {
+	line, err := c.reader.ReadSlice('\n')
+	if err != nil || len(line) > maxProxyProtocolV1Length || !bytes.HasSuffix(line, []byte("\r\n")) {
+		return fmt.Errorf("malformed v1 header")
+	}
+
+	fields := strings.Fields(string(line[:len(line)-2]))
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return fmt.Errorf("malformed v1 header")
+	}
+
+	src, err := parseAddrPort(fields[2], fields[4])
+	if err != nil {
+		return err
+	}
+	dst, err := parseAddrPort(fields[3], fields[5])
+	if err != nil {
+		return err
+	}
+	if src.Addr().Is4() != (fields[1] == "TCP4") || dst.Addr().Is4() != (fields[1] == "TCP4") {
+		return fmt.Errorf("addresses do not match %s", fields[1])
+	}
+
+	c.remote = net.TCPAddrFromAddrPort(src)
+	c.local = net.TCPAddrFromAddrPort(dst)
+	return nil
+}
+
+// parseAddrPort parses the address and port fields of a v1 header
+func parseAddrPort(addr, port string) (netip.AddrPort, error) {
+	ip, err := netip.ParseAddr(addr)
+	if err != nil {
+		return netip.AddrPort{}, fmt.Errorf("invalid address '%s'", addr)
+	}
+	portNumber, err := strconv.ParseUint(port, 10, 16)
+	if err != nil || (len(port) > 1 && port[0] == '0') {
+		return netip.AddrPort{}, fmt.Errorf("invalid port '%s'", port)
+	}
+	return netip.AddrPortFrom(ip, uint16(portNumber)), nil
+}
+
+// readV2 reads a binary header
+func (c *proxyConn) readV2() error {
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(c.reader, header); err != nil {
+		return err
+	}
+
+	version, command := header[12]>>4, header[12]&0x0f
+	if version != 2 || command > 1 {
+		return fmt.Errorf("unsupported v2 version or command 0x%02x", header[12])
+	}
+
+	payload := make([]byte, binary.BigEndian.Uint16(header[14:16]))
+	if _, err := io.ReadFull(c.reader, payload); err != nil {
+		return err
+	}
+
+	// LOCAL connections are health checks of the load balancer itself
+	if command == 0 {
+		return nil
+	}
+
+	var ipLength int
+	switch header[13] {
+	case 0x11, 0x12: // TCP or UDP over IPv4
+		ipLength = 4
+	case 0x21, 0x22: // TCP or UDP over IPv6
+		ipLength = 16
+	default:
+		return nil
+	}
+	if len(payload) < 2*ipLength+4 {
+		return fmt.Errorf("v2 address block too short")
+	}
+
+	srcIP, _ := netip.AddrFromSlice(payload[:ipLength])
+	dstIP, _ := netip.AddrFromSlice(payload[ipLength : 2*ipLength])
+	ports := payload[2*ipLength:]
+	c.remote = net.TCPAddrFromAddrPort(netip.AddrPortFrom(srcIP, binary.BigEndian.Uint16(ports[0:2])))
+	c.local = net.TCPAddrFromAddrPort(netip.AddrPortFrom(dstIP, binary.BigEndian.Uint16(ports[2:4])))
+	return nil
+}
+
+// proxyHeader builds the PROXY protocol header announcing a connection from
+// src to dst. Unknown addresses produce a header without addresses.
+func proxyHeader(version string, src, dst net.Addr) []byte {
+	srcAddr, srcErr := addrPort(src)
+	dstAddr, dstErr := addrPort(dst)
+	known := srcErr == nil && dstErr == nil
+	ipv4 := known && srcAddr.Addr().Is4() && dstAddr.Addr().Is4()
+
+	// Mixed families are announced as IPv6, with IPv4 addresses mapped into it
+	if known && !ipv4 {
+		srcAddr = netip.AddrPortFrom(netip.AddrFrom16(srcAddr.Addr().As16()), srcAddr.Port())
+		dstAddr = netip.AddrPortFrom(netip.AddrFrom16(dstAddr.Addr().As16()), dstAddr.Port())
+	}
+
+	if version == types.ProxyProtocolV1 {
+		if !known {
+			return []byte("PROXY UNKNOWN\r\n")
+		}
+		family := "TCP6"
+		if ipv4 {
+			family = "TCP4"
+		}
+		return fmt.Appendf(nil, "PROXY %s %s %s %d %d\r\n", family, srcAddr.Addr(), dstAddr.Addr(), srcAddr.Port(), dstAddr.Port())
+	}
+
+	header := append([]byte(nil), proxyProtocolV2Signature...)
+	if !known {
+		// LOCAL command without addresses
+		return append(header, 0x20, 0x00, 0x00, 0x00)
+	}
+
+	family, addresses := byte(0x21), make([]byte, 0, 36)
+	if ipv4 {
+		family = 0x11
+		src4, dst4 := srcAddr.Addr().As4(), dstAddr.Addr().As4()
+		addresses = append(append(addresses, src4[:]...), dst4[:]...)
+	} else {
+		src16, dst16 := srcAddr.Addr().As16(), dstAddr.Addr().As16()
+		addresses = append(append(addresses, src16[:]...), dst16[:]...)
+	}
+	addresses = binary.BigEndian.AppendUint16(addresses, srcAddr.Port())
+	addresses = binary.BigEndian.AppendUint16(addresses, dstAddr.Port())
+
+	header = append(header, 0x21, family)
+	header = binary.BigEndian.AppendUint16(header, uint16(len(addresses)))
+	return append(header, addresses...)
+}
+
+// addrPort returns the IP address and port of a network address
+func addrPort(addr net.Addr) (netip.AddrPort, error) {
+	if addr == nil {
+		return netip.AddrPort{}, fmt.Errorf("no address")
+	}
+	return netip.ParseAddrPort(addr.String())
+}
+
+// dialWithProxyProtocol sends a PROXY protocol header announcing the client
+// of the request on every new connection
+func dialWithProxyProtocol(dial func(ctx context.Context, network, address string) (net.Conn, error), version string) func(ctx context.Context, network, address string) (net.Conn, error) {
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		conn, err := dial(ctx, network, address)
+		if err != nil {
+			return nil, err
+		}
+
+		var src, dst net.Addr
+		if clientAddr, ok := ctx.Value(clientAddrKey{}).(string); ok {
+			src = stringAddr(clientAddr)
+		}
+		if localAddr, ok := ctx.Value(http.LocalAddrContextKey).(net.Addr); ok {
+			dst = localAddr
+		}
+
+		if _, err := conn.Write(proxyHeader(version, src, dst)); err != nil {
+			_ = conn.Close()
+			return nil, fmt.Errorf("failed to send PROXY protocol header: %w", err)
+		}
+		return conn, nil
+	}
+}
+
+// stringAddr is a TCP address held as its string form, such as the remote
+// address of a request
+type stringAddr string
+
+// Network returns the network of the address
+func (a stringAddr) Network() string {
+	return "tcp"
+}
+
+// String returns the address
+func (a stringAddr) String() string {
+	return string(a)
+}
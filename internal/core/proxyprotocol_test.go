@@ -0,0 +1,307 @@
+package core
+
+import (
+	"AegisGate/internal/logger"
+	"AegisGate/pkg/types"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// pipeAddr is the address of both ends of a net.Pipe
+const pipeAddr = "pipe"
+
+// readHeader reads the PROXY protocol header of a connection that sends data
+// and closes
+func readHeader(t *testing.T, data []byte) (net.Conn, error) {
+	t.Helper()
+	client, server := net.Pipe()
+	t.Cleanup(func() { _ = server.Close() })
+	go func() {
+		_, _ = client.Write(data)
+		_ = client.Close()
+	}()
+	return readProxyHeader(server, time.Second)
+}
+
+// v2Header builds a binary header with a command byte, a family byte and an
+// address block
+func v2Header(command, family byte, addresses []byte) []byte {
+	header := append([]byte(nil), proxyProtocolV2Signature...)
+	header = append(header, command, family)
+	header = binary.BigEndian.AppendUint16(header, uint16(len(addresses)))
+	return append(header, addresses...)
+}
+
+func TestReadProxyHeader(t *testing.T) {
+	ipv4Block := []byte{192, 0, 2, 1, 198, 51, 100, 7, 0xdc, 0x04, 0x01, 0xbb}
+	ipv6Block := make([]byte, 36)
+	ipv6Block[0], ipv6Block[1], ipv6Block[15] = 0x20, 0x01, 0x01
+	ipv6Block[16], ipv6Block[17], ipv6Block[31] = 0x20, 0x01, 0x02
+	binary.BigEndian.PutUint16(ipv6Block[32:], 56324)
+	binary.BigEndian.PutUint16(ipv6Block[34:], 443)
+
+	tests := []struct {
+		name    string
+		header  []byte
+		remote  string
+		local   string
+		wantErr bool
+	}{
+		{
+			name:   "v1 TCP4",
+			header: []byte("PROXY TCP4 192.0.2.1 198.51.100.7 56324 443\r\n"),
+			remote: "192.0.2.1:56324",
+			local:  "198.51.100.7:443",
+		},
+		{
+			name:   "v1 TCP6",
+			header: []byte("PROXY TCP6 2001:db8::1 2001:db8::2 56324 443\r\n"),
+			remote: "[2001:db8::1]:56324",
+			local:  "[2001:db8::2]:443",
+		},
+		{
+			name:   "v1 UNKNOWN",
+			header: []byte("PROXY UNKNOWN\r\n"),
+			remote: pipeAddr,
+			local:  pipeAddr,
+		},
+		{
+			name:   "v1 UNKNOWN with addresses",
+			header: []byte("PROXY UNKNOWN 192.0.2.1 198.51.100.7 56324 443\r\n"),
+			remote: pipeAddr,
+			local:  pipeAddr,
+		},
+		{name: "v1 oversized", header: []byte("PROXY TCP4 192.0.2.1 198.51.100.7 56324 443" + strings.Repeat(" ", 100) + "\r\n"), wantErr: true},
+		{name: "v1 without CRLF", header: []byte("PROXY TCP4 192.0.2.1 198.51.100.7 56324 443\n"), wantErr: true},
+		{name: "v1 unterminated", header: []byte("PROXY TCP4 192.0.2.1 198.51.100.7 56324 443"), wantErr: true},
+		{name: "v1 missing port", header: []byte("PROXY TCP4 192.0.2.1 198.51.100.7 56324\r\n"), wantErr: true},
+		{name: "v1 family mismatch", header: []byte("PROXY TCP4 2001:db8::1 2001:db8::2 56324 443\r\n"), wantErr: true},
+		{name: "v1 invalid address", header: []byte("PROXY TCP4 192.0.2.256 198.51.100.7 56324 443\r\n"), wantErr: true},
+		{name: "v1 port out of range", header: []byte("PROXY TCP4 192.0.2.1 198.51.100.7 65536 443\r\n"), wantErr: true},
+		{name: "v1 port with leading zero", header: []byte("PROXY TCP4 192.0.2.1 198.51.100.7 056324 443\r\n"), wantErr: true},
+		{name: "v1 unsupported protocol", header: []byte("PROXY UDP4 192.0.2.1 198.51.100.7 56324 443\r\n"), wantErr: true},
+		{
+			name:   "v2 PROXY TCP4",
+			header: v2Header(0x21, 0x11, ipv4Block),
+			remote: "192.0.2.1:56324",
+			local:  "198.51.100.7:443",
+		},
+		{
+			name:   "v2 PROXY TCP6",
+			header: v2Header(0x21, 0x21, ipv6Block),
+			remote: "[2001::1]:56324",
+			local:  "[2001::2]:443",
+		},
+		{
+			name:   "v2 PROXY with TLVs",
+			header: v2Header(0x21, 0x11, append(append([]byte(nil), ipv4Block...), 0x04, 0x00, 0x01, 0x00)),
+			remote: "192.0.2.1:56324",
+			local:  "198.51.100.7:443",
+		},
+		{
+			name:   "v2 LOCAL",
+			header: v2Header(0x20, 0x00, nil),
+			remote: pipeAddr,
+			local:  pipeAddr,
+		},
+		{
+			name:   "v2 LOCAL with addresses",
+			header: v2Header(0x20, 0x11, ipv4Block),
+			remote: pipeAddr,
+			local:  pipeAddr,
+		},
+		{
+			name:   "v2 unspecified family",
+			header: v2Header(0x21, 0x00, nil),
+			remote: pipeAddr,
+			local:  pipeAddr,
+		},
+		{name: "v2 short IPv4 block", header: v2Header(0x21, 0x11, ipv4Block[:8]), wantErr: true},
+		{name: "v2 short IPv6 block", header: v2Header(0x21, 0x21, ipv4Block), wantErr: true},
+		{name: "v2 truncated block", header: v2Header(0x21, 0x11, ipv4Block)[:20], wantErr: true},
+		{name: "v2 truncated header", header: v2Header(0x21, 0x11, ipv4Block)[:14], wantErr: true},
+		{name: "v2 unsupported version", header: v2Header(0x11, 0x11, ipv4Block), wantErr: true},
+		{name: "v2 unsupported command", header: v2Header(0x22, 0x11, ipv4Block), wantErr: true},
+		{name: "no header", header: []byte("GET / HTTP/1.1\r\nHost: example.com\r\n\r\n"), wantErr: true},
+		{name: "short connection", header: []byte("PROXY"), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, err := readHeader(t, append(tt.header, "payload"...))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("readProxyHeader() remote = %s, want error", conn.RemoteAddr())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("readProxyHeader() error = %v", err)
+			}
+			if got := conn.RemoteAddr().String(); got != tt.remote {
+				t.Errorf("RemoteAddr() = %s, want %s", got, tt.remote)
+			}
+			if got := conn.LocalAddr().String(); got != tt.local {
+				t.Errorf("LocalAddr() = %s, want %s", got, tt.local)
+			}
+
+			data, err := io.ReadAll(conn)
+			if err != nil {
+				t.Fatalf("reading after the header error = %v", err)
+			}
+			if string(data) != "payload" {
+				t.Errorf("data after the header = %q, want %q", data, "payload")
+			}
+		})
+	}
+}
+
+func TestReadProxyHeaderTimeout(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	go func() {
+		_, _ = client.Write([]byte("PROXY TCP4 "))
+	}()
+	if _, err := readProxyHeader(server, 50*time.Millisecond); err == nil {
+		t.Fatal("readProxyHeader() of an incomplete header succeeded, want error")
+	}
+}
+
+func TestProxyHeaderRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		src    net.Addr
+		dst    net.Addr
+		remote string
+		local  string
+	}{
+		{
+			name:   "IPv4",
+			src:    stringAddr("192.0.2.1:56324"),
+			dst:    stringAddr("198.51.100.7:443"),
+			remote: "192.0.2.1:56324",
+			local:  "198.51.100.7:443",
+		},
+		{
+			name:   "IPv6",
+			src:    stringAddr("[2001:db8::1]:56324"),
+			dst:    stringAddr("[2001:db8::2]:443"),
+			remote: "[2001:db8::1]:56324",
+			local:  "[2001:db8::2]:443",
+		},
+		{
+			name:   "mixed families",
+			src:    stringAddr("192.0.2.1:56324"),
+			dst:    stringAddr("[2001:db8::2]:443"),
+			remote: "192.0.2.1:56324", // Mapped into IPv6 on the wire
+			local:  "[2001:db8::2]:443",
+		},
+		{
+			name:   "unknown source",
+			dst:    stringAddr("198.51.100.7:443"),
+			remote: pipeAddr,
+			local:  pipeAddr,
+		},
+	}
+
+	for _, version := range []string{types.ProxyProtocolV1, types.ProxyProtocolV2} {
+		for _, tt := range tests {
+			t.Run(version+"/"+tt.name, func(t *testing.T) {
+				conn, err := readHeader(t, proxyHeader(version, tt.src, tt.dst))
+				if err != nil {
+					t.Fatalf("readProxyHeader() error = %v", err)
+				}
+				if got := conn.RemoteAddr().String(); got != tt.remote {
+					t.Errorf("RemoteAddr() = %s, want %s", got, tt.remote)
+				}
+				if got := conn.LocalAddr().String(); got != tt.local {
+					t.Errorf("LocalAddr() = %s, want %s", got, tt.local)
+				}
+			})
+		}
+	}
+}
+
+// scriptedListener returns the results queued in accepts, and net.ErrClosed once closed
+type scriptedListener struct {
+	accepts chan func() (net.Conn, error)
+	done    chan struct{}
+	once    sync.Once
+}
+
+func (l *scriptedListener) Accept() (net.Conn, error) {
+	select {
+	case accept := <-l.accepts:
+		return accept()
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *scriptedListener) Close() error {
+	l.once.Do(func() { close(l.done) })
+	return nil
+}
+
+func (l *scriptedListener) Addr() net.Addr {
+	return stringAddr("127.0.0.1:8080")
+}
+
+func TestProxyProtocolListenerRetriesAcceptErrors(t *testing.T) {
+	ln := &scriptedListener{accepts: make(chan func() (net.Conn, error), 2), done: make(chan struct{})}
+	client, server := net.Pipe()
+	defer client.Close()
+
+	ln.accepts <- func() (net.Conn, error) {
+		return nil, &net.OpError{Op: "accept", Net: "tcp", Err: os.NewSyscallError("accept", syscall.EMFILE)}
+	}
+	ln.accepts <- func() (net.Conn, error) {
+		return server, nil
+	}
+
+	pl := newProxyProtocolListener(ln, types.ProxyProtocolConfig{Enabled: true, TrustedCIDRs: []string{"10.0.0.0/8"}}, logger.New(false))
+	defer pl.Close()
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, err := pl.Accept()
+		if err != nil {
+			t.Errorf("Accept() error = %v", err)
+		}
+		accepted <- conn
+	}()
+
+	select {
+	case conn := <-accepted:
+		if conn != server {
+			t.Errorf("Accept() = %v, want the connection accepted after the error", conn)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Accept() did not return the connection accepted after the error")
+	}
+
+	_ = ln.Close()
+	errs := make(chan error, 1)
+	go func() {
+		_, err := pl.Accept()
+		errs <- err
+	}()
+	select {
+	case err := <-errs:
+		if !errors.Is(err, net.ErrClosed) {
+			t.Errorf("Accept() after closing error = %v, want %v", err, net.ErrClosed)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Accept() did not return after the listener was closed")
+	}
+}
@@ -0,0 +1,190 @@
+package core
+
+import (
+	"AegisGate/pkg/types"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"reflect"
+	"sync"
+
+	"github.com/quic-go/quic-go/http3"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// listenerServer serves a single configured listener
+type listenerServer struct {
+	config     types.ListenerConfig
+	server     *http.Server
+	listener   net.Listener
+	http3      *http3.Server  // Nil unless HTTP/3 is enabled
+	packetConn net.PacketConn // UDP socket of the HTTP/3 server
+}
+
+// http3Name returns the name of the UDP socket of a listener's HTTP/3 server
+func http3Name(listener string) string {
+	return listener + ".h3"
+}
+
+// newListenerServer creates the HTTP server of a listener
+func newListenerServer(config types.ListenerConfig, handler http.Handler) (*listenerServer, error) {
+	server := &http.Server{
+		Addr:              config.Address,
+		ReadHeaderTimeout: config.Timeouts.ReadHeader.Std(),
+		ReadTimeout:       config.Timeouts.Read.Std(),
+		WriteTimeout:      config.Timeouts.Write.Std(),
+		IdleTimeout:       config.Timeouts.Idle.Std(),
+		MaxHeaderBytes:    int(config.MaxHeaderBytes),
+	}
+
+	s := &listenerServer{config: config, server: server}
+
+	switch config.Protocol {
+	case types.ProtocolHTTPS:
+		tlsConfig, err := newTLSConfig(config.TLS)
+		if err != nil {
+			return nil, fmt.Errorf("listener %s: %w", config.Name, err)
+		}
+		server.TLSConfig = tlsConfig
+
+		if config.HTTP3.Enabled {
+			s.http3 = &http3.Server{
+				Handler:        handler,
+				TLSConfig:      tlsConfig,
+				IdleTimeout:    config.Timeouts.Idle.Std(),
+				MaxHeaderBytes: int(config.MaxHeaderBytes),
+			}
+			altSvc, err := altSvcHeader(config.HTTP3)
+			if err != nil {
+				return nil, fmt.Errorf("listener %s: %w", config.Name, err)
+			}
+			handler = withAltSvc(handler, altSvc)
+		}
+	case types.ProtocolH2C:
+		h2s := &http2.Server{IdleTimeout: config.Timeouts.Idle.Std()}
+		handler = h2c.NewHandler(handler, h2s)
+	}
+	server.Handler = handler
+
+	return s, nil
+}
+
+// altSvcHeader returns the Alt-Svc header advertising the HTTP/3 endpoint of a listener
+func altSvcHeader(config types.HTTP3Config) (string, error) {
+	_, port, err := net.SplitHostPort(config.Address)
+	if err != nil {
+		return "", fmt.Errorf("invalid http3 address: %w", err)
+	}
+	return fmt.Sprintf(`h3=":%s"; ma=%d`, port, int(config.AltSvcMaxAge.Std().Seconds())), nil
+}
+
+// withAltSvc advertises HTTP/3 on the responses of a TCP listener
+func withAltSvc(next http.Handler, altSvc string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Alt-Svc", altSvc)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// serve accepts connections on the bound listener
+func (s *listenerServer) serve(ln net.Listener) error {
+	if s.config.Protocol == types.ProtocolHTTPS {
+		return s.server.ServeTLS(ln, "", "")
+	}
+	return s.server.Serve(ln)
+}
+
+// serveHTTP3 accepts QUIC connections on the bound UDP socket
+func (s *listenerServer) serveHTTP3() error {
+	return s.http3.Serve(s.packetConn)
+}
+
+// shutdown stops accepting connections and waits for in-flight requests to
+// complete until ctx is done, then closes the remaining connections
+func (s *listenerServer) shutdown(ctx context.Context) error {
+	var http3Err error
+	var wg sync.WaitGroup
+	if s.http3 != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if http3Err = s.http3.Shutdown(ctx); http3Err != nil {
+				_ = s.http3.Close()
+			}
+			_ = s.packetConn.Close()
+		}()
+	}
+
+	err := s.server.Shutdown(ctx)
+	if err != nil {
+		_ = s.server.Close()
+	}
+	wg.Wait()
+
+	return errors.Join(err, http3Err)
+}
+
+// close closes the listener and all its connections immediately
+func (s *listenerServer) close() error {
+	err := s.server.Close()
+	if s.http3 != nil {
+		err = errors.Join(err, s.http3.Close(), s.packetConn.Close())
+	}
+	return err
+}
+
+// newTLSConfig loads the certificates of an HTTPS listener
+func newTLSConfig(config types.TLSConfig) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(config.CertFile, config.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load certificate: %w", err)
+	}
+
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if config.MinVersion == "1.3" {
+		tlsConfig.MinVersion = tls.VersionTLS13
+	}
+
+	if config.ClientCAFile != "" {
+		pem, err := os.ReadFile(config.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read client CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in client CA file %s", config.ClientCAFile)
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return tlsConfig, nil
+}
+
+// checkListeners returns an error if the listeners of a new configuration
+// differ from the bound ones in anything but the services they serve, since
+// listeners are only bound at startup
+func checkListeners(bound []*listenerServer, listeners []types.ListenerConfig) error {
+	if len(bound) != len(listeners) {
+		return fmt.Errorf("listeners changed, restart or upgrade the gateway to apply")
+	}
+
+	for i, s := range bound {
+		current, updated := s.config, listeners[i]
+		current.Services, updated.Services = nil, nil
+		if !reflect.DeepEqual(current, updated) {
+			return fmt.Errorf("listener %s changed, restart or upgrade the gateway to apply", s.config.Name)
+		}
+	}
+
+	return nil
+}
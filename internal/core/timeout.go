@@ -0,0 +1,206 @@
+package core
+
+import (
+	"AegisGate/pkg/types"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// timeoutError is the cause of a request that was cancelled because a phase
+// of the request to the target took too long
+type timeoutError struct {
+	phase   string
+	timeout time.Duration
+}
+
+// Error describes the phase that timed out
+func (e *timeoutError) Error() string {
+	return fmt.Sprintf("%s timeout of %v exceeded", e.phase, e.timeout)
+}
+
+// upstreamTimeoutsKey is the context key of the upstream timeouts of a request
+type upstreamTimeoutsKey struct{}
+
+// streamingContentTypes are the content types of responses that stream events
+var streamingContentTypes = []string{
+	"text/event-stream",
+	"application/x-ndjson",
+	"application/stream+json",
+}
+
+// withTimeouts applies the route timeouts to a request. On streaming routes,
+// and for responses that turn out to be streams, the total timeout ends once
+// the response headers arrive. The returned function releases the timers and
+// must be called once the request has completed.
+func withTimeouts(r *http.Request, total types.Duration, timeouts types.UpstreamTimeouts, streaming bool) (*http.Request, func()) {
+	if total <= 0 && timeouts == (types.UpstreamTimeouts{}) {
+		return r, func() {}
+	}
+
+	ctx, cancel := context.WithCancelCause(r.Context())
+	value := &upstreamTimeouts{
+		UpstreamTimeouts: timeouts,
+		streaming:        streaming,
+		cancel:           cancel,
+	}
+
+	if total > 0 {
+		value.total = time.AfterFunc(total.Std(), func() {
+			cancel(&timeoutError{phase: "request", timeout: total.Std()})
+		})
+	}
+
+	if timeouts.FirstByte > 0 {
+		ctx = httptrace.WithClientTrace(ctx, firstByteTrace(timeouts.FirstByte.Std(), cancel))
+	}
+	ctx = context.WithValue(ctx, upstreamTimeoutsKey{}, value)
+
+	return r.WithContext(ctx), func() {
+		if value.total != nil {
+			value.total.Stop()
+		}
+		cancel(nil)
+	}
+}
+
+// upstreamTimeouts holds the timeouts of a request together with the function
+// cancelling it
+type upstreamTimeouts struct {
+	types.UpstreamTimeouts
+	streaming bool
+	total     *time.Timer
+	cancel    context.CancelCauseFunc
+}
+
+// firstByteTrace cancels the request if the response headers do not arrive in
+// time after the request was written
+func firstByteTrace(timeout time.Duration, cancel context.CancelCauseFunc) *httptrace.ClientTrace {
+	var (
+		mu    sync.Mutex
+		timer *time.Timer
+		done  bool
+	)
+
+	return &httptrace.ClientTrace{
+		WroteRequest: func(httptrace.WroteRequestInfo) {
+			mu.Lock()
+			defer mu.Unlock()
+			if !done && timer == nil {
+				timer = time.AfterFunc(timeout, func() {
+					cancel(&timeoutError{phase: "first byte", timeout: timeout})
+				})
+			}
+		},
+		GotFirstResponseByte: func() {
+			mu.Lock()
+			defer mu.Unlock()
+			done = true
+			if timer != nil {
+				timer.Stop()
+			}
+		},
+	}
+}
+
+// dialWithConnectTimeout limits the time allowed to connect to the connect
+// timeout of the request the connection is made for
+func dialWithConnectTimeout(dial func(ctx context.Context, network, address string) (net.Conn, error)) func(ctx context.Context, network, address string) (net.Conn, error) {
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		timeouts, ok := ctx.Value(upstreamTimeoutsKey{}).(*upstreamTimeouts)
+		if !ok || timeouts.Connect <= 0 {
+			return dial(ctx, network, address)
+		}
+
+		ctx, cancel := context.WithTimeoutCause(ctx, timeouts.Connect.Std(), &timeoutError{phase: "connect", timeout: timeouts.Connect.Std()})
+		defer cancel()
+
+		conn, err := dial(ctx, network, address)
+		var timeoutErr *timeoutError
+		if err != nil && errors.As(context.Cause(ctx), &timeoutErr) {
+			return nil, fmt.Errorf("%w: %w", timeoutErr, err)
+		}
+		return conn, err
+	}
+}
+
+// applyStreamingTimeouts ends the total timeout of streaming responses and
+// cancels the request if the response body goes without data for longer than
+// the idle stream timeout
+func applyStreamingTimeouts(resp *http.Response) {
+	timeouts, ok := resp.Request.Context().Value(upstreamTimeoutsKey{}).(*upstreamTimeouts)
+	if !ok {
+		return
+	}
+
+	if timeouts.total != nil && (timeouts.streaming || isStreamingResponse(resp)) {
+		timeouts.total.Stop()
+	}
+
+	if timeouts.IdleStream <= 0 {
+		return
+	}
+
+	timeout := timeouts.IdleStream.Std()
+	cancel := timeouts.cancel
+	resp.Body = &idleTimeoutBody{
+		ReadCloser: resp.Body,
+		timeout:    timeout,
+		timer: time.AfterFunc(timeout, func() {
+			cancel(&timeoutError{phase: "idle stream", timeout: timeout})
+		}),
+	}
+}
+
+// isStreamingResponse reports whether a response streams events. gRPC
+// responses are treated as streams since any call may be a streaming RPC.
+func isStreamingResponse(resp *http.Response) bool {
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	return slices.Contains(streamingContentTypes, mediaType) || strings.HasPrefix(mediaType, "application/grpc")
+}
+
+// idleTimeoutBody restarts the idle timer whenever data is read
+type idleTimeoutBody struct {
+	io.ReadCloser
+	timeout time.Duration
+	timer   *time.Timer
+}
+
+// Read reads from the body and restarts the idle timer
+func (b *idleTimeoutBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		b.timer.Reset(b.timeout)
+	}
+	return n, err
+}
+
+// Close stops the idle timer and closes the body
+func (b *idleTimeoutBody) Close() error {
+	b.timer.Stop()
+	return b.ReadCloser.Close()
+}
+
+// isTimeout reports whether a proxy error was caused by a timeout
+func isTimeout(r *http.Request, err error) bool {
+	var timeoutErr *timeoutError
+	if errors.As(context.Cause(r.Context()), &timeoutErr) || errors.As(err, &timeoutErr) {
+		return true
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
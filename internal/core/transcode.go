@@ -0,0 +1,834 @@
+package core
+
+import (
+	"AegisGate/internal/logger"
+	"AegisGate/pkg/types"
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// httpRuleExtension is the method option holding google.api.http annotations
+const httpRuleExtension = "google.api.http"
+
+// errUnknownField is returned when a request parameter names no field of the request message
+var errUnknownField = errors.New("unknown field")
+
+// maxTranscodedResponseSize limits the gRPC responses buffered for conversion
+// to JSON, matching the default maximum message size of gRPC clients
+const maxTranscodedResponseSize = 4 << 20
+
+// errTranscodedResponseTooLarge is returned when a gRPC response exceeds maxTranscodedResponseSize
+var errTranscodedResponseTooLarge = errors.New("gRPC response exceeds the maximum size of transcoded responses")
+
+// transcoder maps the REST/JSON routes of a gRPC service to its methods,
+// described by a compiled FileDescriptorSet
+type transcoder struct {
+	service  types.ServiceConfig
+	files    *protoregistry.Files
+	types    *dynamicpb.Types
+	httpRule protoreflect.ExtensionType // Nil if the descriptor set lacks google/api/annotations.proto
+}
+
+// newTranscoder loads the descriptor set of a service, and returns nil for
+// services without transcoded routes
+func newTranscoder(service types.ServiceConfig) (*transcoder, error) {
+	if service.Transcoding.DescriptorSet == "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(service.Transcoding.DescriptorSet)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read descriptor set: %w", err)
+	}
+
+	set := &descriptorpb.FileDescriptorSet{}
+	if err := proto.Unmarshal(data, set); err != nil {
+		return nil, fmt.Errorf("failed to parse descriptor set %s: %w", service.Transcoding.DescriptorSet, err)
+	}
+
+	files, err := protodesc.NewFiles(set)
+	if err != nil {
+		return nil, fmt.Errorf("invalid descriptor set %s (compile it with --include_imports): %w", service.Transcoding.DescriptorSet, err)
+	}
+
+	t := &transcoder{
+		service: service,
+		files:   files,
+		types:   dynamicpb.NewTypes(files),
+	}
+
+	if desc, err := files.FindDescriptorByName(httpRuleExtension); err == nil {
+		if xd, ok := desc.(protoreflect.ExtensionDescriptor); ok {
+			t.httpRule = dynamicpb.NewExtensionType(xd)
+		}
+	}
+	if service.Transcoding.Annotations && t.httpRule == nil {
+		return nil, fmt.Errorf("descriptor set %s does not include google/api/annotations.proto", service.Transcoding.DescriptorSet)
+	}
+
+	return t, nil
+}
+
+// annotatedRoutes returns a route for every google.api.http binding of the
+// methods in the descriptor set. Methods mapped by configured routes keep only
+// those, and bindings the gateway cannot route are skipped with a warning.
+// Bindings whose paths conflict with the configured routes or earlier bindings
+// fail the load, unless the service skips them.
+func (t *transcoder) annotatedRoutes(l *logger.Logger, configured *routeSet) ([]types.Route, error) {
+	mapped := make(map[string]bool)
+	for _, route := range t.service.Routes {
+		mapped[route.GRPC.Method] = true
+	}
+
+	// Order the files so that the routes are the same on every load
+	files := make([]protoreflect.FileDescriptor, 0, t.files.NumFiles())
+	t.files.RangeFiles(func(file protoreflect.FileDescriptor) bool {
+		files = append(files, file)
+		return true
+	})
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Path() < files[j].Path()
+	})
+
+	routes := make([]types.Route, 0)
+	for _, file := range files {
+		services := file.Services()
+		for i := 0; i < services.Len(); i++ {
+			service := services.Get(i)
+			if len(t.service.Transcoding.Services) > 0 && !slices.Contains(t.service.Transcoding.Services, string(service.FullName())) {
+				continue
+			}
+
+			methods := service.Methods()
+			for j := 0; j < methods.Len(); j++ {
+				method := methods.Get(j)
+				name := grpcMethodName(method)
+				if mapped[name] {
+					continue
+				}
+
+				rule, err := t.methodHTTPRule(method)
+				if err != nil {
+					l.Info("Skipping annotations of %s: %v", name, err)
+					continue
+				}
+				if rule == nil {
+					continue
+				}
+
+				for _, route := range ruleRoutes(name, rule) {
+					transcoded, err := t.bind(route)
+					if err != nil {
+						l.Info("Skipping binding %v %s of %s: %v", route.Methods, route.Path, name, err)
+						continue
+					}
+
+					// The router cannot hold conflicting paths, so such bindings are unreachable
+					if err := configured.add(route.Methods[0].String(), transcoded.path); err != nil {
+						if !t.service.Transcoding.SkipConflictingBindings {
+							return nil, fmt.Errorf("binding %v %s of %s conflicts with another route (set transcoding.skip_conflicting_bindings to skip it): %w", route.Methods, route.Path, name, err)
+						}
+						l.Error("Skipping conflicting binding %v %s of %s: %v", route.Methods, route.Path, name, err)
+						continue
+					}
+					routes = append(routes, route)
+				}
+			}
+		}
+	}
+
+	return routes, nil
+}
+
+// methodHTTPRule returns the google.api.http annotation of a method, or nil if it has none
+func (t *transcoder) methodHTTPRule(method protoreflect.MethodDescriptor) (protoreflect.Message, error) {
+	options, ok := method.Options().(*descriptorpb.MethodOptions)
+	if !ok || options == nil {
+		return nil, nil
+	}
+
+	// The annotation is an unknown field until parsed with the extension from the descriptor set
+	data, err := proto.Marshal(options)
+	if err != nil {
+		return nil, err
+	}
+	resolver := new(protoregistry.Types)
+	if err := resolver.RegisterExtension(t.httpRule); err != nil {
+		return nil, err
+	}
+	parsed := &descriptorpb.MethodOptions{}
+	if err := (proto.UnmarshalOptions{Resolver: resolver}).Unmarshal(data, parsed); err != nil {
+		return nil, err
+	}
+
+	field := t.httpRule.TypeDescriptor()
+	if !parsed.ProtoReflect().Has(field) {
+		return nil, nil
+	}
+	return parsed.ProtoReflect().Get(field).Message(), nil
+}
+
+// ruleRoutes converts a google.api.http rule and its additional bindings to routes
+func ruleRoutes(method string, rule protoreflect.Message) []types.Route {
+	fields := rule.Descriptor().Fields()
+	route := types.Route{
+		GRPC: types.GRPCMapping{
+			Method:       method,
+			Body:         rule.Get(fields.ByName("body")).String(),
+			ResponseBody: rule.Get(fields.ByName("response_body")).String(),
+		},
+	}
+
+	for _, name := range []protoreflect.Name{"get", "put", "post", "delete", "patch"} {
+		if field := fields.ByName(name); rule.Has(field) {
+			route.Methods = []types.HTTPMethod{types.HTTPMethod(strings.ToUpper(string(name)))}
+			route.Path = rule.Get(field).String()
+		}
+	}
+	if field := fields.ByName("custom"); rule.Has(field) {
+		custom := rule.Get(field).Message()
+		customFields := custom.Descriptor().Fields()
+		route.Methods = []types.HTTPMethod{types.HTTPMethod(custom.Get(customFields.ByName("kind")).String())}
+		route.Path = custom.Get(customFields.ByName("path")).String()
+	}
+
+	routes := make([]types.Route, 0, 1)
+	if route.Path != "" {
+		routes = append(routes, route)
+	}
+
+	additional := rule.Get(fields.ByName("additional_bindings")).List()
+	for i := 0; i < additional.Len(); i++ {
+		routes = append(routes, ruleRoutes(method, additional.Get(i).Message())...)
+	}
+
+	return routes
+}
+
+// grpcMethodName returns the name of a method as used in routes, e.g. library.v1.Library/GetBook
+func grpcMethodName(method protoreflect.MethodDescriptor) string {
+	return fmt.Sprintf("%s/%s", method.Parent().FullName(), method.Name())
+}
+
+// transcodedRoute converts the JSON requests of a route to calls of a gRPC
+// method and the responses back to JSON
+type transcodedRoute struct {
+	method       protoreflect.MethodDescriptor
+	path         string // httprouter path
+	grpcPath     string // Path of the method on the target
+	variables    []pathVariable
+	body         string
+	bodyField    protoreflect.FieldDescriptor
+	responseBody protoreflect.FieldDescriptor
+	unmarshal    protojson.UnmarshalOptions
+	marshal      protojson.MarshalOptions
+}
+
+// bind resolves the gRPC method of a route and compiles its path template
+func (t *transcoder) bind(route types.Route) (*transcodedRoute, error) {
+	serviceName, methodName, _ := strings.Cut(route.GRPC.Method, "/")
+	desc, err := t.files.FindDescriptorByName(protoreflect.FullName(serviceName))
+	if err != nil {
+		return nil, fmt.Errorf("gRPC service %s not found in descriptor set", serviceName)
+	}
+	service, ok := desc.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a gRPC service", serviceName)
+	}
+	method := service.Methods().ByName(protoreflect.Name(methodName))
+	if method == nil {
+		return nil, fmt.Errorf("gRPC method %s not found in descriptor set", route.GRPC.Method)
+	}
+	if method.IsStreamingClient() || method.IsStreamingServer() {
+		return nil, fmt.Errorf("streaming method %s cannot be transcoded", route.GRPC.Method)
+	}
+
+	template, err := parsePathTemplate(joinPath(t.service.BasePath, route.Path))
+	if err != nil {
+		return nil, err
+	}
+
+	tr := &transcodedRoute{
+		method:    method,
+		path:      template.path,
+		grpcPath:  "/" + route.GRPC.Method,
+		variables: template.variables,
+		body:      route.GRPC.Body,
+		unmarshal: protojson.UnmarshalOptions{Resolver: t.types},
+		marshal:   protojson.MarshalOptions{Resolver: t.types},
+	}
+
+	for _, variable := range tr.variables {
+		if _, err := fieldPath(method.Input(), variable.field); err != nil {
+			return nil, fmt.Errorf("path variable %s: %w", variable.field, err)
+		}
+	}
+
+	if tr.body != "" && tr.body != "*" {
+		if tr.bodyField, err = messageField(method.Input(), tr.body); err != nil {
+			return nil, fmt.Errorf("body: %w", err)
+		}
+	}
+	if route.GRPC.ResponseBody != "" {
+		if tr.responseBody, err = messageField(method.Output(), route.GRPC.ResponseBody); err != nil {
+			return nil, fmt.Errorf("response_body: %w", err)
+		}
+	}
+
+	return tr, nil
+}
+
+// messageField returns a top-level singular message field of a message
+func messageField(message protoreflect.MessageDescriptor, name string) (protoreflect.FieldDescriptor, error) {
+	field := findField(message, name)
+	if field == nil {
+		return nil, fmt.Errorf("%w %s in %s", errUnknownField, name, message.FullName())
+	}
+	if field.Message() == nil || field.IsList() || field.IsMap() {
+		return nil, fmt.Errorf("field %s must be a singular message", name)
+	}
+	return field, nil
+}
+
+// ServeHTTP calls the gRPC method through the service proxy with the request
+// converted to protobuf, and writes the response as JSON
+func (tr *transcodedRoute) ServeHTTP(w http.ResponseWriter, r *http.Request, ps httprouter.Params, proxy *ServiceProxy, route types.Route) {
+	request, err := tr.request(r, ps)
+	if isBodyTooLarge(err) {
+		httpError(w, r, "Request Entity Too Large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		writeTranscodedError(w, grpcInvalidArgument, err.Error())
+		return
+	}
+
+	payload, err := proto.Marshal(request)
+	if err != nil {
+		writeTranscodedError(w, grpcInternal, err.Error())
+		return
+	}
+
+	// Length-prefixed gRPC message, uncompressed
+	frame := make([]byte, 5+len(payload))
+	binary.BigEndian.PutUint32(frame[1:5], uint32(len(payload)))
+	copy(frame[5:], payload)
+
+	outReq := r.Clone(r.Context())
+	outReq.Method = http.MethodPost
+	outReq.URL.Path = tr.grpcPath
+	outReq.URL.RawPath = ""
+	outReq.URL.RawQuery = ""
+	outReq.Body = io.NopCloser(bytes.NewReader(frame))
+	outReq.ContentLength = int64(len(frame))
+	outReq.Header.Del("Content-Length")
+	outReq.Header.Del("Content-Encoding")
+	outReq.Header.Del("Accept-Encoding")
+	outReq.Header.Set("Content-Type", "application/grpc")
+	outReq.Header.Set("Te", "trailers")
+
+	// The gRPC path is absolute, the base path is not stripped from it
+	route.StripPath = false
+
+	rec := &grpcRecorder{header: make(http.Header), status: http.StatusOK, limit: maxTranscodedResponseSize}
+	rec.record(proxy, outReq, route)
+
+	tr.writeResponse(w, rec)
+}
+
+// request builds the request message from the body, the path variables and
+// the query parameters of a request
+func (tr *transcodedRoute) request(r *http.Request, ps httprouter.Params) (*dynamicpb.Message, error) {
+	message := dynamicpb.NewMessage(tr.method.Input())
+
+	// The body is decoded first, since decoding resets the message
+	if tr.body != "" {
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read body: %w", err)
+		}
+		if len(bytes.TrimSpace(data)) > 0 {
+			target := protoreflect.Message(message)
+			if tr.bodyField != nil {
+				target = message.Mutable(tr.bodyField).Message()
+			}
+			if err := tr.unmarshal.Unmarshal(data, target.Interface()); err != nil {
+				return nil, fmt.Errorf("invalid body: %w", err)
+			}
+		}
+	}
+
+	bound := make(map[string]bool, len(tr.variables))
+	for _, variable := range tr.variables {
+		if err := setField(message, variable.field, []string{variable.value(ps)}); err != nil {
+			return nil, fmt.Errorf("path variable %s: %w", variable.field, err)
+		}
+		bound[variable.field] = true
+	}
+
+	// Query parameters fill the fields not taken by the path or the body
+	if tr.body == "*" {
+		return message, nil
+	}
+	for key, values := range r.URL.Query() {
+		if bound[key] || (tr.bodyField != nil && (key == tr.body || strings.HasPrefix(key, tr.body+"."))) {
+			continue
+		}
+		if err := setField(message, key, values); err != nil && !errors.Is(err, errUnknownField) {
+			return nil, fmt.Errorf("query parameter %s: %w", key, err)
+		}
+	}
+
+	return message, nil
+}
+
+// writeResponse converts the gRPC response recorded from the target to JSON
+func (tr *transcodedRoute) writeResponse(w http.ResponseWriter, rec *grpcRecorder) {
+	if rec.exceeded {
+		writeTranscodedStatus(w, http.StatusBadGateway, grpcResourceExhausted, errTranscodedResponseTooLarge.Error())
+		return
+	}
+
+	status := rec.header.Get("Grpc-Status")
+	if status == "" {
+		status = rec.header.Get(http.TrailerPrefix + "Grpc-Status")
+	}
+	if status == "" {
+		writeTranscodedError(w, grpcUnknown, fmt.Sprintf("target responded with HTTP status %d and no gRPC status", rec.status))
+		return
+	}
+
+	code, err := strconv.Atoi(status)
+	if err != nil {
+		writeTranscodedError(w, grpcUnknown, fmt.Sprintf("invalid gRPC status %q", status))
+		return
+	}
+	if code != grpcOK {
+		message := rec.header.Get("Grpc-Message")
+		if message == "" {
+			message = rec.header.Get(http.TrailerPrefix + "Grpc-Message")
+		}
+		if unescaped, err := url.PathUnescape(message); err == nil {
+			message = unescaped
+		}
+		writeTranscodedError(w, code, message)
+		return
+	}
+
+	response := dynamicpb.NewMessage(tr.method.Output())
+	if err := readGRPCMessage(rec.body.Bytes(), response); err != nil {
+		writeTranscodedError(w, grpcInternal, err.Error())
+		return
+	}
+
+	result := protoreflect.Message(response)
+	if tr.responseBody != nil {
+		result = response.Get(tr.responseBody).Message()
+	}
+	data, err := tr.marshal.Marshal(result.Interface())
+	if err != nil {
+		writeTranscodedError(w, grpcInternal, err.Error())
+		return
+	}
+
+	// protojson varies its whitespace between runs, responses should not
+	var compacted bytes.Buffer
+	if err := json.Compact(&compacted, data); err == nil {
+		data = compacted.Bytes()
+	}
+
+	// Pass on the response headers that are not specific to gRPC
+	for key, values := range rec.header {
+		lower := strings.ToLower(key)
+		if strings.HasPrefix(lower, "grpc-") || strings.HasPrefix(key, http.TrailerPrefix) ||
+			lower == "content-type" || lower == "content-length" || lower == "trailer" {
+			continue
+		}
+		w.Header()[key] = values
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(data)
+}
+
+// readGRPCMessage decodes the single length-prefixed message of a unary gRPC response
+func readGRPCMessage(data []byte, message proto.Message) error {
+	if len(data) < 5 {
+		return fmt.Errorf("target responded without a message")
+	}
+	if data[0] != 0 {
+		return fmt.Errorf("target responded with a compressed message")
+	}
+	length := binary.BigEndian.Uint32(data[1:5])
+	if uint64(len(data)-5) < uint64(length) {
+		return fmt.Errorf("target responded with a truncated message")
+	}
+	if err := proto.Unmarshal(data[5:5+length], message); err != nil {
+		return fmt.Errorf("invalid response message: %w", err)
+	}
+	return nil
+}
+
+// transcodedError is the JSON body of a failed transcoded request
+type transcodedError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// writeTranscodedError writes a gRPC error as a JSON response with the matching HTTP status
+func writeTranscodedError(w http.ResponseWriter, code int, message string) {
+	writeTranscodedStatus(w, httpStatus(code), code, message)
+}
+
+// writeTranscodedStatus writes a gRPC error as a JSON response with an HTTP status
+func writeTranscodedStatus(w http.ResponseWriter, status, code int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(transcodedError{Code: code, Message: message})
+}
+
+// grpcRecorder buffers the gRPC response of a transcoded request. Trailers
+// end up in the header map, as the proxy sets them after the body.
+type grpcRecorder struct {
+	header   http.Header
+	status   int
+	body     bytes.Buffer
+	limit    int64
+	exceeded bool // The body exceeded the limit and was not recorded
+}
+
+// record sends a request to the target and records its response
+func (rec *grpcRecorder) record(proxy *ServiceProxy, r *http.Request, route types.Route) {
+	// The reverse proxy aborts the handler when the body exceeds the limit
+	defer func() {
+		if !rec.exceeded {
+			return
+		}
+		if v := recover(); v != nil && v != http.ErrAbortHandler {
+			panic(v)
+		}
+	}()
+
+	proxy.ServeHTTP(rec, r, route)
+}
+
+// Header returns the response headers and trailers
+func (rec *grpcRecorder) Header() http.Header {
+	return rec.header
+}
+
+// WriteHeader records the status code
+func (rec *grpcRecorder) WriteHeader(status int) {
+	rec.status = status
+}
+
+// Write buffers the response body, failing once it exceeds the limit
+func (rec *grpcRecorder) Write(p []byte) (int, error) {
+	if int64(rec.body.Len()+len(p)) > rec.limit {
+		rec.exceeded = true
+		return 0, errTranscodedResponseTooLarge
+	}
+	return rec.body.Write(p)
+}
+
+// Flush does nothing, the response is converted once complete
+func (rec *grpcRecorder) Flush() {}
+
+// pathTemplate is a google.api.http path template compiled to an httprouter path
+type pathTemplate struct {
+	path      string
+	variables []pathVariable
+}
+
+// pathVariable binds a request field to router path segments. Segments
+// starting with ':' or '*' name router parameters, others are literals.
+type pathVariable struct {
+	field    string
+	segments []string
+}
+
+// value reassembles the value of the variable from the router parameters
+func (v pathVariable) value(ps httprouter.Params) string {
+	parts := make([]string, len(v.segments))
+	for i, segment := range v.segments {
+		switch segment[0] {
+		case ':':
+			parts[i] = ps.ByName(segment[1:])
+		case '*':
+			parts[i] = strings.TrimPrefix(ps.ByName(segment[1:]), "/")
+		default:
+			parts[i] = segment
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+// parsePathTemplate compiles a path template such as
+// /v1/{name=shelves/*}/books/{book_id}. Wildcards become router parameters
+// named after their position, since httprouter requires wildcards at the same
+// position to share a name, as in /v1/{parent=shelves/*}/books and
+// /v1/{name=shelves/*/books/*}. '**' must end the path.
+func parsePathTemplate(template string) (*pathTemplate, error) {
+	if !strings.HasPrefix(template, "/") {
+		return nil, fmt.Errorf("path template %s must start with '/'", template)
+	}
+
+	t := &pathTemplate{}
+	if template == "/" {
+		t.path = template
+		return t, nil
+	}
+
+	segments := make([]string, 0)
+
+	// segment returns the router segment of a template segment
+	segment := func(pattern string) (string, error) {
+		name := fmt.Sprintf("p%d", len(segments)+1)
+		switch pattern {
+		case "*":
+			return ":" + name, nil
+		case "**":
+			return "*" + name, nil
+		}
+		if pattern == "" || strings.ContainsAny(pattern, "{}*:=") {
+			return "", fmt.Errorf("invalid segment '%s' in path template %s", pattern, template)
+		}
+		return pattern, nil
+	}
+
+	rest := template[1:]
+	for {
+		if strings.HasPrefix(rest, "{") {
+			end := strings.IndexByte(rest, '}')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated variable in path template %s", template)
+			}
+			field, pattern, found := strings.Cut(rest[1:end], "=")
+			if !found {
+				pattern = "*"
+			}
+			if field == "" {
+				return nil, fmt.Errorf("unnamed variable in path template %s", template)
+			}
+
+			variable := pathVariable{field: field}
+			for _, part := range strings.Split(pattern, "/") {
+				routerSegment, err := segment(part)
+				if err != nil {
+					return nil, err
+				}
+				segments = append(segments, routerSegment)
+				variable.segments = append(variable.segments, routerSegment)
+			}
+			t.variables = append(t.variables, variable)
+			rest = rest[end+1:]
+		} else {
+			end := strings.IndexByte(rest, '/')
+			if end < 0 {
+				end = len(rest)
+			}
+			part := rest[:end]
+			if strings.Contains(part, ":") {
+				return nil, fmt.Errorf("custom verbs are not supported in path template %s", template)
+			}
+			routerSegment, err := segment(part)
+			if err != nil {
+				return nil, err
+			}
+			segments = append(segments, routerSegment)
+			rest = rest[end:]
+		}
+
+		if rest == "" {
+			break
+		}
+		if !strings.HasPrefix(rest, "/") {
+			if strings.HasPrefix(rest, ":") {
+				return nil, fmt.Errorf("custom verbs are not supported in path template %s", template)
+			}
+			return nil, fmt.Errorf("invalid path template %s", template)
+		}
+		rest = rest[1:]
+		if rest == "" {
+			// Trailing slash
+			segments = append(segments, "")
+			break
+		}
+	}
+
+	for i, routerSegment := range segments {
+		if strings.HasPrefix(routerSegment, "*") && i != len(segments)-1 {
+			return nil, fmt.Errorf("'**' must be the last segment of path template %s", template)
+		}
+	}
+
+	t.path = "/" + strings.Join(segments, "/")
+	return t, nil
+}
+
+// joinPath combines a base path and a route path with a single slash
+func joinPath(basePath, routePath string) string {
+	return fmt.Sprintf("%s/%s", strings.TrimSuffix(basePath, "/"), strings.TrimPrefix(routePath, "/"))
+}
+
+// findField looks up a field by its proto or JSON name
+func findField(message protoreflect.MessageDescriptor, name string) protoreflect.FieldDescriptor {
+	fields := message.Fields()
+	if field := fields.ByName(protoreflect.Name(name)); field != nil {
+		return field
+	}
+	return fields.ByJSONName(name)
+}
+
+// fieldPath resolves a dotted field path such as book.author.name
+func fieldPath(message protoreflect.MessageDescriptor, path string) ([]protoreflect.FieldDescriptor, error) {
+	names := strings.Split(path, ".")
+	fields := make([]protoreflect.FieldDescriptor, 0, len(names))
+	for i, name := range names {
+		field := findField(message, name)
+		if field == nil {
+			return nil, fmt.Errorf("%w %s in %s", errUnknownField, name, message.FullName())
+		}
+		if field.IsMap() {
+			return nil, fmt.Errorf("map field %s cannot be set from a parameter", name)
+		}
+		fields = append(fields, field)
+		if i == len(names)-1 {
+			break
+		}
+		if field.Message() == nil || field.IsList() {
+			return nil, fmt.Errorf("field %s is not a singular message", name)
+		}
+		message = field.Message()
+	}
+	return fields, nil
+}
+
+// setField sets the field at a dotted path from parameter values. Repeated
+// fields take every value, others the last one.
+func setField(message protoreflect.Message, path string, values []string) error {
+	fields, err := fieldPath(message.Descriptor(), path)
+	if err != nil {
+		return err
+	}
+	for _, field := range fields[:len(fields)-1] {
+		message = message.Mutable(field).Message()
+	}
+
+	field := fields[len(fields)-1]
+	if field.IsList() {
+		list := message.Mutable(field).List()
+		for _, s := range values {
+			value, err := parseFieldValue(field, s)
+			if err != nil {
+				return err
+			}
+			list.Append(value)
+		}
+		return nil
+	}
+
+	value, err := parseFieldValue(field, values[len(values)-1])
+	if err != nil {
+		return err
+	}
+	message.Set(field, value)
+	return nil
+}
+
+// parseFieldValue parses a parameter value for a field. Message fields accept
+// the JSON string form of well-known types such as google.protobuf.Timestamp.
+func parseFieldValue(field protoreflect.FieldDescriptor, s string) (protoreflect.Value, error) {
+	switch field.Kind() {
+	case protoreflect.StringKind:
+		return protoreflect.ValueOfString(s), nil
+	case protoreflect.BytesKind:
+		b, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			if b, err = base64.URLEncoding.DecodeString(s); err != nil {
+				return protoreflect.Value{}, fmt.Errorf("invalid base64 value %q", s)
+			}
+		}
+		return protoreflect.ValueOfBytes(b), nil
+	case protoreflect.BoolKind:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return protoreflect.Value{}, fmt.Errorf("invalid bool value %q", s)
+		}
+		return protoreflect.ValueOfBool(b), nil
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		n, err := strconv.ParseInt(s, 10, 32)
+		if err != nil {
+			return protoreflect.Value{}, fmt.Errorf("invalid int32 value %q", s)
+		}
+		return protoreflect.ValueOfInt32(int32(n)), nil
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return protoreflect.Value{}, fmt.Errorf("invalid int64 value %q", s)
+		}
+		return protoreflect.ValueOfInt64(n), nil
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		n, err := strconv.ParseUint(s, 10, 32)
+		if err != nil {
+			return protoreflect.Value{}, fmt.Errorf("invalid uint32 value %q", s)
+		}
+		return protoreflect.ValueOfUint32(uint32(n)), nil
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		n, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return protoreflect.Value{}, fmt.Errorf("invalid uint64 value %q", s)
+		}
+		return protoreflect.ValueOfUint64(n), nil
+	case protoreflect.FloatKind:
+		f, err := strconv.ParseFloat(s, 32)
+		if err != nil {
+			return protoreflect.Value{}, fmt.Errorf("invalid float value %q", s)
+		}
+		return protoreflect.ValueOfFloat32(float32(f)), nil
+	case protoreflect.DoubleKind:
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return protoreflect.Value{}, fmt.Errorf("invalid double value %q", s)
+		}
+		return protoreflect.ValueOfFloat64(f), nil
+	case protoreflect.EnumKind:
+		if value := field.Enum().Values().ByName(protoreflect.Name(s)); value != nil {
+			return protoreflect.ValueOfEnum(value.Number()), nil
+		}
+		n, err := strconv.ParseInt(s, 10, 32)
+		if err != nil {
+			return protoreflect.Value{}, fmt.Errorf("invalid value %q for enum %s", s, field.Enum().FullName())
+		}
+		return protoreflect.ValueOfEnum(protoreflect.EnumNumber(n)), nil
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		value := dynamicpb.NewMessage(field.Message())
+		if err := protojson.Unmarshal([]byte(strconv.Quote(s)), value); err != nil {
+			return protoreflect.Value{}, fmt.Errorf("invalid value %q for %s", s, field.Message().FullName())
+		}
+		return protoreflect.ValueOfMessage(value), nil
+	default:
+		return protoreflect.Value{}, fmt.Errorf("unsupported field type %s", field.Kind())
+	}
+}
@@ -0,0 +1,366 @@
+package core
+
+import (
+	"AegisGate/internal/health"
+	"AegisGate/internal/logger"
+	"AegisGate/pkg/types"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// httpRuleFieldNumber is the field number of the google.api.http extension
+const httpRuleFieldNumber = 72295728
+
+// httpProto describes google/api/http.proto, reduced to the fields the transcoder reads
+var httpProto = &descriptorpb.FileDescriptorProto{
+	Name:    proto.String("google/api/http.proto"),
+	Package: proto.String("google.api"),
+	Syntax:  proto.String("proto3"),
+	MessageType: []*descriptorpb.DescriptorProto{
+		{
+			Name: proto.String("HttpRule"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				stringField("selector", 1),
+				oneofField(stringField("get", 2)),
+				oneofField(stringField("put", 3)),
+				oneofField(stringField("post", 4)),
+				oneofField(stringField("delete", 5)),
+				oneofField(stringField("patch", 6)),
+				oneofField(messageFieldProto("custom", 8, ".google.api.CustomHttpPattern", false)),
+				stringField("body", 7),
+				messageFieldProto("additional_bindings", 11, ".google.api.HttpRule", true),
+				stringField("response_body", 12),
+			},
+			OneofDecl: []*descriptorpb.OneofDescriptorProto{{Name: proto.String("pattern")}},
+		},
+		{
+			Name: proto.String("CustomHttpPattern"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				stringField("kind", 1),
+				stringField("path", 2),
+			},
+		},
+	},
+}
+
+// annotationsProto describes google/api/annotations.proto
+var annotationsProto = &descriptorpb.FileDescriptorProto{
+	Name:       proto.String("google/api/annotations.proto"),
+	Package:    proto.String("google.api"),
+	Syntax:     proto.String("proto3"),
+	Dependency: []string{"google/api/http.proto", "google/protobuf/descriptor.proto"},
+	Extension: []*descriptorpb.FieldDescriptorProto{{
+		Name:     proto.String("http"),
+		Number:   proto.Int32(httpRuleFieldNumber),
+		Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+		Type:     descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum(),
+		TypeName: proto.String(".google.api.HttpRule"),
+		Extendee: proto.String(".google.protobuf.MethodOptions"),
+		JsonName: proto.String("http"),
+	}},
+}
+
+func stringField(name string, number int32) *descriptorpb.FieldDescriptorProto {
+	return &descriptorpb.FieldDescriptorProto{
+		Name:     proto.String(name),
+		Number:   proto.Int32(number),
+		Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+		Type:     descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+		JsonName: proto.String(name),
+	}
+}
+
+func messageFieldProto(name string, number int32, typeName string, repeated bool) *descriptorpb.FieldDescriptorProto {
+	label := descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL
+	if repeated {
+		label = descriptorpb.FieldDescriptorProto_LABEL_REPEATED
+	}
+	return &descriptorpb.FieldDescriptorProto{
+		Name:     proto.String(name),
+		Number:   proto.Int32(number),
+		Label:    label.Enum(),
+		Type:     descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum(),
+		TypeName: proto.String(typeName),
+		JsonName: proto.String(name),
+	}
+}
+
+func oneofField(field *descriptorpb.FieldDescriptorProto) *descriptorpb.FieldDescriptorProto {
+	field.OneofIndex = proto.Int32(0)
+	return field
+}
+
+// annotatedMethod describes a unary method of the test service with a GET binding
+type annotatedMethod struct {
+	name string
+	path string
+}
+
+// writeDescriptorSet writes a descriptor set with a library.v1.Library service
+// whose methods are annotated with GET bindings, and returns its path
+func writeDescriptorSet(t *testing.T, methods []annotatedMethod) string {
+	t.Helper()
+
+	httpFile, err := protodesc.NewFile(httpProto, protoregistry.GlobalFiles)
+	if err != nil {
+		t.Fatalf("failed to build http.proto: %v", err)
+	}
+	httpRule := httpFile.Messages().ByName("HttpRule")
+
+	library := &descriptorpb.FileDescriptorProto{
+		Name:       proto.String("library/v1/library.proto"),
+		Package:    proto.String("library.v1"),
+		Syntax:     proto.String("proto3"),
+		Dependency: []string{"google/api/annotations.proto"},
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name:  proto.String("Book"),
+			Field: []*descriptorpb.FieldDescriptorProto{stringField("name", 1)},
+		}},
+		Service: []*descriptorpb.ServiceDescriptorProto{{Name: proto.String("Library")}},
+	}
+
+	for _, method := range methods {
+		rule := dynamicpb.NewMessage(httpRule)
+		rule.Set(httpRule.Fields().ByName("get"), protoreflect.ValueOfString(method.path))
+		data, err := proto.Marshal(rule)
+		if err != nil {
+			t.Fatalf("failed to marshal rule: %v", err)
+		}
+
+		options := &descriptorpb.MethodOptions{}
+		extension := protowire.AppendTag(nil, httpRuleFieldNumber, protowire.BytesType)
+		options.ProtoReflect().SetUnknown(protowire.AppendBytes(extension, data))
+
+		library.Service[0].Method = append(library.Service[0].Method, &descriptorpb.MethodDescriptorProto{
+			Name:       proto.String(method.name),
+			InputType:  proto.String(".library.v1.Book"),
+			OutputType: proto.String(".library.v1.Book"),
+			Options:    options,
+		})
+	}
+
+	set := &descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{
+		protodesc.ToFileDescriptorProto(descriptorpb.File_google_protobuf_descriptor_proto),
+		httpProto,
+		annotationsProto,
+		library,
+	}}
+	data, err := proto.Marshal(set)
+	if err != nil {
+		t.Fatalf("failed to marshal descriptor set: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "library.pb")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatalf("failed to write descriptor set: %v", err)
+	}
+	return path
+}
+
+// conflictingMethods are annotated methods whose bindings conflict with each
+// other and with the configured route of conflictingService
+var conflictingMethods = []annotatedMethod{
+	{name: "CountBooks", path: "/v1/books/count"},
+	{name: "GetBook", path: "/v1/books/{name}"},     // Conflicts with the static path of CountBooks
+	{name: "ListBooks", path: "/v1/books"},          // Shares a prefix without conflicting
+	{name: "GetShelf", path: "/v1/shelves/{name}"},  // Conflicts with the configured route
+	{name: "CountShelves", path: "/v1/books/count"}, // Repeats the path of CountBooks
+	{name: "ListShelves", path: "/v1/shelves/list"}, // A static sibling of the configured route
+}
+
+// conflictingService returns a service routing the bindings of conflictingMethods
+func conflictingService(t *testing.T, skip bool) types.ServiceConfig {
+	t.Helper()
+	return types.ServiceConfig{
+		Name:     "library",
+		BasePath: "/api",
+		Protocol: types.ServiceProtocolGRPC,
+		Transcoding: types.TranscodingConfig{
+			DescriptorSet:           writeDescriptorSet(t, conflictingMethods),
+			Annotations:             true,
+			SkipConflictingBindings: skip,
+		},
+	}
+}
+
+// configuredRoutes returns the route set of the configured routes of conflictingService
+func configuredRoutes(t *testing.T) *routeSet {
+	t.Helper()
+	configured := newRouteSet()
+	if err := configured.add("GET", "/api/v1/shelves/default"); err != nil {
+		t.Fatalf("add() error = %v", err)
+	}
+	return configured
+}
+
+func TestAnnotatedRoutesSkipsConflicts(t *testing.T) {
+	transcoder, err := newTranscoder(conflictingService(t, true))
+	if err != nil {
+		t.Fatalf("newTranscoder() error = %v", err)
+	}
+
+	routes, err := transcoder.annotatedRoutes(logger.New(false), configuredRoutes(t))
+	if err != nil {
+		t.Fatalf("annotatedRoutes() error = %v", err)
+	}
+
+	var methods []string
+	for _, route := range routes {
+		methods = append(methods, route.GRPC.Method)
+	}
+
+	want := []string{"library.v1.Library/CountBooks", "library.v1.Library/ListBooks", "library.v1.Library/ListShelves"}
+	if !slices.Equal(methods, want) {
+		t.Errorf("annotatedRoutes() methods = %v, want %v", methods, want)
+	}
+}
+
+func TestAnnotatedRoutesRejectsConflicts(t *testing.T) {
+	transcoder, err := newTranscoder(conflictingService(t, false))
+	if err != nil {
+		t.Fatalf("newTranscoder() error = %v", err)
+	}
+
+	routes, err := transcoder.annotatedRoutes(logger.New(false), configuredRoutes(t))
+	if err == nil {
+		t.Fatalf("annotatedRoutes() = %d routes, want error", len(routes))
+	}
+	if !strings.Contains(err.Error(), "GetBook") {
+		t.Errorf("annotatedRoutes() error = %v, want the conflict of GetBook", err)
+	}
+}
+
+func TestHandleRouteConflict(t *testing.T) {
+	set := newRouteSet()
+	if err := set.add("GET", "/v1/books/count"); err != nil {
+		t.Fatalf("add() error = %v", err)
+	}
+	if err := set.add("GET", "/v1/books/:p3"); err == nil {
+		t.Error("add() of a wildcard next to a static segment succeeded, want error")
+	}
+	if err := set.add("GET", "/v1/books/count"); err == nil {
+		t.Error("add() of a duplicate path succeeded, want error")
+	}
+	if err := set.add("POST", "/v1/books/:p3"); err != nil {
+		t.Errorf("add() with another method error = %v", err)
+	}
+}
+
+func TestParsePathTemplate(t *testing.T) {
+	tests := []struct {
+		template  string
+		path      string
+		variables []pathVariable
+		wantErr   bool
+	}{
+		{template: "/", path: "/"},
+		{template: "/v1/books", path: "/v1/books"},
+		{template: "/v1/books/", path: "/v1/books/"},
+		{
+			template:  "/v1/books/{name}",
+			path:      "/v1/books/:p3",
+			variables: []pathVariable{{field: "name", segments: []string{":p3"}}},
+		},
+		{
+			template: "/v1/{parent=shelves/*}/books/{book.id}",
+			path:     "/v1/shelves/:p3/books/:p5",
+			variables: []pathVariable{
+				{field: "parent", segments: []string{"shelves", ":p3"}},
+				{field: "book.id", segments: []string{":p5"}},
+			},
+		},
+		{
+			template:  "/v1/{name=files/**}",
+			path:      "/v1/files/*p3",
+			variables: []pathVariable{{field: "name", segments: []string{"files", "*p3"}}},
+		},
+		{template: "/v1/*/books", path: "/v1/:p2/books"},
+		{template: "v1/books", wantErr: true},
+		{template: "/v1/books/{name", wantErr: true},
+		{template: "/v1/books/{=*}", wantErr: true},
+		{template: "/v1/books:count", wantErr: true},
+		{template: "/v1/books/{name}:cancel", wantErr: true},
+		{template: "/v1/{name=**}/books", wantErr: true},
+		{template: "/v1//books", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.template, func(t *testing.T) {
+			got, err := parsePathTemplate(tt.template)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parsePathTemplate() = %+v, want error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parsePathTemplate() error = %v", err)
+			}
+			if got.path != tt.path {
+				t.Errorf("path = %q, want %q", got.path, tt.path)
+			}
+			if len(got.variables) != len(tt.variables) {
+				t.Fatalf("variables = %+v, want %+v", got.variables, tt.variables)
+			}
+			for i, variable := range got.variables {
+				if variable.field != tt.variables[i].field || !slices.Equal(variable.segments, tt.variables[i].segments) {
+					t.Errorf("variables[%d] = %+v, want %+v", i, variable, tt.variables[i])
+				}
+			}
+		})
+	}
+}
+
+func TestGRPCRecorderLimit(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/grpc")
+		for range 64 {
+			_, _ = w.Write([]byte("0123456789abcdef"))
+			w.(http.Flusher).Flush()
+		}
+	}))
+	defer target.Close()
+
+	service := types.ServiceConfig{Name: "library", TargetURL: target.URL}
+	proxies := NewProxyManager(logger.New(false))
+	if err := proxies.AddService(service, health.NewTarget(service.Name, target.URL, types.CircuitBreakerConfig{}), http.DefaultTransport); err != nil {
+		t.Fatalf("AddService() error = %v", err)
+	}
+	proxy, err := proxies.GetProxy(service.Name)
+	if err != nil {
+		t.Fatalf("GetProxy() error = %v", err)
+	}
+
+	// The reverse proxy only aborts the handler of requests served by an http.Server
+	r := httptest.NewRequest(http.MethodPost, "/library.v1.Library/GetBook", nil)
+	r = r.WithContext(context.WithValue(r.Context(), http.ServerContextKey, &http.Server{}))
+
+	rec := &grpcRecorder{header: make(http.Header), status: http.StatusOK, limit: 100}
+	rec.record(proxy, r, types.Route{})
+	if !rec.exceeded {
+		t.Fatalf("record() of %d bytes with a limit of 100 did not exceed it", rec.body.Len())
+	}
+	if rec.body.Len() > 100 {
+		t.Errorf("recorded %d bytes, want at most 100", rec.body.Len())
+	}
+
+	w := httptest.NewRecorder()
+	(&transcodedRoute{}).writeResponse(w, rec)
+	if w.Code != http.StatusBadGateway {
+		t.Errorf("writeResponse() status = %d, want %d", w.Code, http.StatusBadGateway)
+	}
+}
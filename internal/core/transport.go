@@ -0,0 +1,231 @@
+package core
+
+import (
+	"AegisGate/pkg/types"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+// Defaults of Go's HTTP client for the settings that have to be set explicitly
+const (
+	defaultDialTimeout = 30 * time.Second
+	defaultKeepAlive   = 30 * time.Second
+)
+
+// dnsPort is appended to DNS servers configured without a port
+const dnsPort = "53"
+
+// transport is the connection pool used to reach the target of a service
+type transport struct {
+	config       types.TransportConfig
+	targetURL    string
+	roundTripper http.RoundTripper
+}
+
+// newTransport creates the transport for a service target
+func newTransport(config types.TransportConfig, targetURL *url.URL) *transport {
+	dialer := &net.Dialer{
+		Timeout:   defaultDialTimeout,
+		KeepAlive: defaultKeepAlive,
+	}
+	if config.DialTimeout > 0 {
+		dialer.Timeout = config.DialTimeout.Std()
+	}
+	if config.KeepAlive != 0 {
+		dialer.KeepAlive = config.KeepAlive.Std()
+	}
+
+	dial := dialer.DialContext
+	switch {
+	case targetURL.Scheme == types.UnixScheme:
+		// Every connection goes to the socket, whatever host the request is for
+		dial = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, "unix", targetURL.Path)
+		}
+	case len(config.DNS.Servers) > 0 || config.DNS.RefreshInterval > 0:
+		dial = newDNSResolver(config.DNS, dialer).dial
+	}
+	dial = dialWithConnectTimeout(dial)
+	if config.SendProxyProtocol != "" {
+		dial = dialWithProxyProtocol(dial, config.SendProxyProtocol)
+	}
+
+	t := &transport{
+		config:    config,
+		targetURL: targetURL.String(),
+	}
+
+	// HTTP/2 without TLS requires prior knowledge, which only the http2 package supports
+	if config.HTTP2 && targetURL.Scheme != "https" {
+		t.roundTripper = &http2.Transport{
+			AllowHTTP: true,
+			DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+				return dial(ctx, network, addr)
+			},
+			DisableCompression: config.DisableCompression,
+			IdleConnTimeout:    config.IdleConnTimeout.Std(),
+		}
+		return t
+	}
+
+	httpTransport := http.DefaultTransport.(*http.Transport).Clone()
+	httpTransport.DialContext = dial
+	// Like Go's HTTP client, HTTP/2 is negotiated with https targets unless disabled. A
+	// PROXY protocol header announces a single client, so connections cannot be multiplexed.
+	http2Allowed := !config.DisableHTTP2 && config.SendProxyProtocol == ""
+	httpTransport.ForceAttemptHTTP2 = http2Allowed
+	httpTransport.DisableCompression = config.DisableCompression
+	httpTransport.ResponseHeaderTimeout = config.ResponseHeaderTimeout.Std()
+	httpTransport.MaxConnsPerHost = config.MaxConnsPerHost
+	// A PROXY protocol header announces a single client, so connections cannot be shared
+	httpTransport.DisableKeepAlives = config.SendProxyProtocol != ""
+	if config.TLSHandshakeTimeout > 0 {
+		httpTransport.TLSHandshakeTimeout = config.TLSHandshakeTimeout.Std()
+	}
+	if config.IdleConnTimeout > 0 {
+		httpTransport.IdleConnTimeout = config.IdleConnTimeout.Std()
+	}
+	if config.MaxIdleConns > 0 {
+		httpTransport.MaxIdleConns = config.MaxIdleConns
+	}
+	if config.MaxIdleConnsPerHost > 0 {
+		httpTransport.MaxIdleConnsPerHost = config.MaxIdleConnsPerHost
+	}
+	// The clone may carry the HTTP/2 setup of the default transport. A nil map
+	// sets up HTTP/2 for this transport, an empty one disables it.
+	httpTransport.TLSNextProto = nil
+	if !http2Allowed {
+		httpTransport.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
+	}
+	t.roundTripper = httpTransport
+
+	return t
+}
+
+// RoundTrip sends a request to the target
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.roundTripper.RoundTrip(req)
+}
+
+// CloseIdleConnections closes the idle connections in the pool
+func (t *transport) CloseIdleConnections() {
+	if closer, ok := t.roundTripper.(interface{ CloseIdleConnections() }); ok {
+		closer.CloseIdleConnections()
+	}
+}
+
+// reusableFor reports whether the transport can be kept for a service after a reload
+func (t *transport) reusableFor(service types.ServiceConfig) bool {
+	return t.targetURL == service.TargetURL && reflect.DeepEqual(t.config, service.GetTransport())
+}
+
+// dnsResolver resolves target hosts with the configured DNS servers and
+// caches the addresses for the refresh interval
+type dnsResolver struct {
+	resolver *net.Resolver
+	refresh  time.Duration
+	dialer   *net.Dialer
+	mu       sync.Mutex
+	cache    map[string]dnsEntry
+}
+
+// dnsEntry holds the resolved addresses of a host
+type dnsEntry struct {
+	addrs    []string
+	resolved time.Time
+}
+
+// newDNSResolver creates a new dnsResolver dialing through dialer
+func newDNSResolver(config types.DNSConfig, dialer *net.Dialer) *dnsResolver {
+	r := &dnsResolver{
+		resolver: net.DefaultResolver,
+		refresh:  config.RefreshInterval.Std(),
+		dialer:   dialer,
+		cache:    make(map[string]dnsEntry),
+	}
+
+	if len(config.Servers) > 0 {
+		servers := make([]string, len(config.Servers))
+		for i, server := range config.Servers {
+			if _, _, err := net.SplitHostPort(server); err != nil {
+				server = net.JoinHostPort(server, dnsPort)
+			}
+			servers[i] = server
+		}
+
+		// Spread queries over the servers
+		var next atomic.Uint32
+		r.resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				server := servers[int(next.Add(1)-1)%len(servers)]
+				return dialer.DialContext(ctx, network, server)
+			},
+		}
+	}
+
+	return r
+}
+
+// dial connects to the first reachable address of the host
+func (r *dnsResolver) dial(ctx context.Context, network, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	if net.ParseIP(host) != nil {
+		return r.dialer.DialContext(ctx, network, address)
+	}
+
+	addrs, err := r.lookup(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	var errs []error
+	for _, addr := range addrs {
+		conn, err := r.dialer.DialContext(ctx, network, net.JoinHostPort(addr, port))
+		if err == nil {
+			return conn, nil
+		}
+		errs = append(errs, err)
+	}
+	return nil, fmt.Errorf("failed to connect to %s: %w", host, errors.Join(errs...))
+}
+
+// lookup returns the addresses of a host, resolving it again once the refresh
+// interval has passed. Stale addresses are used if resolving fails.
+func (r *dnsResolver) lookup(ctx context.Context, host string) ([]string, error) {
+	r.mu.Lock()
+	entry, cached := r.cache[host]
+	r.mu.Unlock()
+
+	if cached && time.Since(entry.resolved) < r.refresh {
+		return entry.addrs, nil
+	}
+
+	addrs, err := r.resolver.LookupHost(ctx, host)
+	if err != nil {
+		if cached {
+			return entry.addrs, nil
+		}
+		return nil, err
+	}
+
+	r.mu.Lock()
+	r.cache[host] = dnsEntry{addrs: addrs, resolved: time.Now()}
+	r.mu.Unlock()
+
+	return addrs, nil
+}
@@ -0,0 +1,219 @@
+package core
+
+import (
+	"AegisGate/internal/logger"
+	"AegisGate/pkg/types"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// maxDatagramSize is the size of the buffers datagrams are read into
+const maxDatagramSize = 64 * 1024
+
+// udpService proxies the datagrams received on a UDP service socket. Each
+// client address gets a session with its own socket connected to a target.
+type udpService struct {
+	name     string
+	conn     net.PacketConn
+	state    atomic.Pointer[udpState]
+	logger   atomic.Pointer[logger.Logger]
+	mu       sync.Mutex
+	sessions map[string]*udpSession
+	closing  atomic.Bool
+}
+
+// udpState is the configuration of a UDP service, replaced on reload
+type udpState struct {
+	config   types.UDPServiceConfig
+	targets  map[string]*l4Target
+	balancer *balancer
+}
+
+// udpSession relays the datagrams of one client to the target it was assigned
+type udpSession struct {
+	client     net.Addr
+	upstream   net.Conn
+	target     *l4Target
+	lastActive atomic.Int64 // Unix time in nanoseconds of the last datagram in either direction
+}
+
+// touch records traffic on the session
+func (s *udpSession) touch() {
+	s.lastActive.Store(time.Now().UnixNano())
+}
+
+// idleSince returns when the session last had traffic
+func (s *udpSession) idleSince() time.Time {
+	return time.Unix(0, s.lastActive.Load())
+}
+
+// newUDPService creates a UDP service that is not bound yet
+func newUDPService(name string) *udpService {
+	return &udpService{name: name, sessions: make(map[string]*udpSession)}
+}
+
+// udpName returns the name of the socket of a UDP service
+func udpName(service string) string {
+	return service + ".udp"
+}
+
+// configure applies the configuration of the service to new sessions
+func (s *udpService) configure(config types.UDPServiceConfig, l *logger.Logger) {
+	var previous map[string]*l4Target
+	if current := s.state.Load(); current != nil {
+		previous = current.targets
+	}
+
+	state := &udpState{config: config, targets: make(map[string]*l4Target)}
+	state.balancer = &balancer{strategy: config.Balance, targets: l4Targets(config.Name, config.Targets, types.CircuitBreakerConfig{}, previous, state.targets)}
+
+	s.state.Store(state)
+	s.logger.Store(l)
+}
+
+// serve forwards client datagrams until the service is shut down
+func (s *udpService) serve() error {
+	buf := make([]byte, maxDatagramSize)
+	var backoff acceptBackoff
+	for {
+		n, addr, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			if s.closing.Load() {
+				return http.ErrServerClosed
+			}
+			if errors.Is(err, net.ErrClosed) {
+				return err
+			}
+			// Other errors pass, so that one service cannot take the gateway down
+			delay := backoff.next()
+			s.logger.Load().Error("UDP service %s: read error: %v, retrying in %v", s.name, err, delay)
+			time.Sleep(delay)
+			continue
+		}
+		backoff.reset()
+
+		session := s.session(addr)
+		if session == nil {
+			continue
+		}
+		session.touch()
+
+		if _, err := session.upstream.Write(buf[:n]); err != nil {
+			s.logger.Load().Debug("UDP service %s: failed to forward datagram from %s to %s: %v", s.name, addr, session.target.address, err)
+			continue
+		}
+		l4BytesTotal.Add(float64(n), s.name, "udp", "upstream")
+	}
+}
+
+// session returns the session of a client, starting one if needed. It
+// returns nil if the datagram has to be dropped.
+func (s *udpService) session(client net.Addr) *udpSession {
+	key := client.String()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if session, exists := s.sessions[key]; exists {
+		return session
+	}
+
+	state := s.state.Load()
+	l := s.logger.Load()
+	if limit := state.config.MaxSessions; limit > 0 && len(s.sessions) >= limit {
+		l.Debug("UDP service %s dropped datagram from %s: limit of %d sessions reached", s.name, client, limit)
+		l4ConnectionsTotal.Inc(s.name, "udp", l4Rejected)
+		return nil
+	}
+
+	upstream, target, err := state.balancer.dial(s.name, "udp", 0, l)
+	if err != nil {
+		l.Error("UDP service %s: failed to start session for %s: %v", s.name, client, err)
+		l4ConnectionsTotal.Inc(s.name, "udp", l4Failed)
+		return nil
+	}
+
+	session := &udpSession{client: client, upstream: upstream, target: target}
+	session.touch()
+	s.sessions[key] = session
+	target.active.Add(1)
+
+	l4ConnectionsTotal.Inc(s.name, "udp", l4Proxied)
+	l.Debug("UDP service %s: session from %s to %s", s.name, client, target.address)
+
+	go s.relay(key, session, state.config.IdleTimeout.Std())
+	return session
+}
+
+// relay sends the replies of the target back to the client until the session
+// goes idle or the target becomes unreachable
+func (s *udpService) relay(key string, session *udpSession, idle time.Duration) {
+	defer s.endSession(key, session)
+
+	buf := make([]byte, maxDatagramSize)
+	for {
+		if idle > 0 {
+			_ = session.upstream.SetReadDeadline(session.idleSince().Add(idle))
+		}
+
+		n, err := session.upstream.Read(buf)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				// Datagrams from the client keep the session alive too
+				if time.Since(session.idleSince()) < idle {
+					continue
+				}
+				return
+			}
+			if !errors.Is(err, net.ErrClosed) {
+				session.target.health.ReportFailure(err)
+				s.logger.Load().Error("UDP service %s: target %s failed: %v", s.name, session.target.address, err)
+			}
+			return
+		}
+		session.target.health.ReportSuccess()
+		session.touch()
+
+		if _, err := s.conn.WriteTo(buf[:n], session.client); err != nil {
+			s.logger.Load().Debug("UDP service %s: failed to reply to %s: %v", s.name, session.client, err)
+			continue
+		}
+		l4BytesTotal.Add(float64(n), s.name, "udp", "downstream")
+	}
+}
+
+// endSession forgets a session and closes its socket
+func (s *udpService) endSession(key string, session *udpSession) {
+	s.mu.Lock()
+	if s.sessions[key] == session {
+		delete(s.sessions, key)
+	}
+	s.mu.Unlock()
+
+	_ = session.upstream.Close()
+	session.target.active.Add(-1)
+}
+
+// close stops the service and ends all sessions. Datagrams carry no
+// connection state, so there is nothing to drain.
+func (s *udpService) close() error {
+	s.closing.Store(true)
+	err := s.conn.Close()
+
+	s.mu.Lock()
+	sessions := make([]*udpSession, 0, len(s.sessions))
+	for _, session := range s.sessions {
+		sessions = append(sessions, session)
+	}
+	s.mu.Unlock()
+
+	for _, session := range sessions {
+		_ = session.upstream.Close()
+	}
+	return err
+}
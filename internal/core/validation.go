@@ -0,0 +1,286 @@
+package core
+
+import (
+	"AegisGate/internal/metrics"
+	"AegisGate/pkg/types"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+)
+
+// Request validation metrics
+var (
+	validationFailuresTotal = metrics.NewCounter("aegisgate_validation_failures_total", "Requests rejected for not matching the JSON Schemas of their route.", "service", "location")
+)
+
+// Parts of a request that are validated
+const (
+	validationBody  = "body"
+	validationQuery = "query"
+)
+
+// defaultValidatedBodySize limits the request bodies of routes validating
+// them that set no max_body_size, since they are held in memory
+const defaultValidatedBodySize = 1 << 20
+
+// errUnsupportedBody is returned when a validated request body is not JSON
+var errUnsupportedBody = errors.New("request body is not JSON")
+
+// violation is a part of a request that does not match its schema
+type violation struct {
+	Location string `json:"location"` // body or query
+	Pointer  string `json:"pointer"`  // JSON Pointer to the invalid value, empty for the whole body or query
+	Message  string `json:"message"`
+}
+
+// requestValidator checks the requests of a route against its JSON Schemas
+type requestValidator struct {
+	body  *jsonschema.Schema // Nil if bodies are not validated
+	query *jsonschema.Schema // Nil if query parameters are not validated
+}
+
+// newSchemaCompiler creates a compiler for the schemas of a configuration.
+// Schema files, and the files they reference, are loaded once per compiler.
+func newSchemaCompiler() *jsonschema.Compiler {
+	compiler := jsonschema.NewCompiler()
+	compiler.AssertFormat()
+	return compiler
+}
+
+// newRequestValidator compiles the schemas of a route, and returns nil for
+// routes that validate no part of their requests
+func newRequestValidator(compiler *jsonschema.Compiler, config types.RequestValidationConfig) (*requestValidator, error) {
+	if !config.Enabled() {
+		return nil, nil
+	}
+
+	v := &requestValidator{}
+	var err error
+	if config.BodySchema != "" {
+		if v.body, err = compiler.Compile(config.BodySchema); err != nil {
+			return nil, fmt.Errorf("failed to compile body schema: %w", err)
+		}
+	}
+	if config.QuerySchema != "" {
+		if v.query, err = compiler.Compile(config.QuerySchema); err != nil {
+			return nil, fmt.Errorf("failed to compile query schema: %w", err)
+		}
+	}
+	return v, nil
+}
+
+// validate checks the query parameters and JSON body of a request against the
+// schemas of its route. The body is read and replaced by a copy for the target.
+func (v *requestValidator) validate(r *http.Request) ([]violation, error) {
+	var violations []violation
+
+	if v.query != nil {
+		doc := queryDocument(r.URL.Query(), v.query)
+		violations = append(violations, schemaViolations(validationQuery, v.query.Validate(doc))...)
+	}
+
+	if v.body == nil || !hasBody(r) {
+		return violations, nil
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "application/json" && !strings.HasSuffix(mediaType, "+json") {
+		return nil, errUnsupportedBody
+	}
+
+	data, err := io.ReadAll(r.Body)
+	_ = r.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(data))
+	r.ContentLength = int64(len(data))
+
+	if len(bytes.TrimSpace(data)) == 0 {
+		return append(violations, violation{Location: validationBody, Message: "request body is required"}), nil
+	}
+	doc, err := jsonschema.UnmarshalJSON(bytes.NewReader(data))
+	if err != nil {
+		return append(violations, violation{Location: validationBody, Message: "invalid JSON: " + err.Error()}), nil
+	}
+	return append(violations, schemaViolations(validationBody, v.body.Validate(doc))...), nil
+}
+
+// hasBody reports whether a request has a body to validate. Requests whose
+// method carries a body must send one.
+func hasBody(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch:
+		return true
+	}
+	return r.ContentLength != 0
+}
+
+// schemaViolations lists the failed assertions of a validation error, the
+// leaves of its tree of causes
+func schemaViolations(location string, err error) []violation {
+	var validationErr *jsonschema.ValidationError
+	if !errors.As(err, &validationErr) {
+		if err != nil {
+			return []violation{{Location: location, Message: err.Error()}}
+		}
+		return nil
+	}
+
+	var violations []violation
+	var collect func(e *jsonschema.ValidationError)
+	collect = func(e *jsonschema.ValidationError) {
+		if len(e.Causes) > 0 {
+			for _, cause := range e.Causes {
+				collect(cause)
+			}
+			return
+		}
+
+		v := violation{Location: location, Pointer: jsonPointer(e.InstanceLocation)}
+		if output := e.BasicOutput(); output.Error != nil {
+			v.Message = output.Error.String()
+		}
+		if !slices.Contains(violations, v) {
+			violations = append(violations, v)
+		}
+	}
+	collect(validationErr)
+	return violations
+}
+
+// jsonPointer formats the tokens of a location in a document as a JSON Pointer
+func jsonPointer(tokens []string) string {
+	var sb strings.Builder
+	for _, token := range tokens {
+		sb.WriteByte('/')
+		sb.WriteString(strings.ReplaceAll(strings.ReplaceAll(token, "~", "~0"), "/", "~1"))
+	}
+	return sb.String()
+}
+
+// writeViolations replies to a request that does not match its schemas with
+// a 400 listing the violations. gRPC calls receive the first one as status.
+func writeViolations(w http.ResponseWriter, r *http.Request, violations []violation) {
+	if isGRPC(r) {
+		httpError(w, r, violations[0].Message, http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusBadRequest)
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"error":      "invalid request",
+		"violations": violations,
+	})
+}
+
+// queryDocument converts query parameters to the JSON object validated by a
+// schema. Values are strings, or numbers, booleans and arrays where the
+// schema of the parameter expects them.
+func queryDocument(query url.Values, schema *jsonschema.Schema) map[string]any {
+	doc := make(map[string]any, len(query))
+	for name, values := range query {
+		property := propertySchema(resolveSchema(schema), name)
+		if slices.Contains(schemaTypes(property), "array") {
+			items := make([]any, len(values))
+			for i, value := range values {
+				items[i] = queryValue(value, itemsSchema(property))
+			}
+			doc[name] = items
+			continue
+		}
+
+		// Repeated parameters fail schemas that do not expect an array
+		if len(values) > 1 {
+			items := make([]any, len(values))
+			for i, value := range values {
+				items[i] = queryValue(value, property)
+			}
+			doc[name] = items
+			continue
+		}
+		doc[name] = queryValue(values[0], property)
+	}
+	return doc
+}
+
+// queryValue converts a query parameter value to the type its schema expects,
+// leaving it a string if it is not a valid value of that type
+func queryValue(value string, schema *jsonschema.Schema) any {
+	for _, typ := range schemaTypes(schema) {
+		switch typ {
+		case "integer", "number":
+			var number any
+			decoder := json.NewDecoder(strings.NewReader(value))
+			decoder.UseNumber()
+			if err := decoder.Decode(&number); err == nil && !decoder.More() {
+				if n, ok := number.(json.Number); ok {
+					return n
+				}
+			}
+		case "boolean":
+			switch value {
+			case "true":
+				return true
+			case "false":
+				return false
+			}
+		}
+	}
+	return value
+}
+
+// resolveSchema follows the references of a schema to the one declaring types
+func resolveSchema(schema *jsonschema.Schema) *jsonschema.Schema {
+	for schema != nil && schema.Types == nil && schema.Ref != nil {
+		schema = schema.Ref
+	}
+	return schema
+}
+
+// schemaTypes returns the JSON types a schema allows
+func schemaTypes(schema *jsonschema.Schema) []string {
+	schema = resolveSchema(schema)
+	if schema == nil || schema.Types == nil {
+		return nil
+	}
+	return schema.Types.ToStrings()
+}
+
+// propertySchema returns the schema of a property of an object schema
+func propertySchema(schema *jsonschema.Schema, name string) *jsonschema.Schema {
+	if schema == nil {
+		return nil
+	}
+	if property, exists := schema.Properties[name]; exists {
+		return property
+	}
+	for pattern, property := range schema.PatternProperties {
+		if pattern.MatchString(name) {
+			return property
+		}
+	}
+	additional, _ := schema.AdditionalProperties.(*jsonschema.Schema)
+	return additional
+}
+
+// itemsSchema returns the schema of the items of an array schema
+func itemsSchema(schema *jsonschema.Schema) *jsonschema.Schema {
+	schema = resolveSchema(schema)
+	if schema.Items2020 != nil {
+		return schema.Items2020
+	}
+	items, _ := schema.Items.(*jsonschema.Schema)
+	return items
+}
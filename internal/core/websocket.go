@@ -0,0 +1,271 @@
+package core
+
+import (
+	"AegisGate/pkg/types"
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/http/httpguts"
+)
+
+// Causes of WebSocket connections being closed by the gateway
+var (
+	errWebSocketReloaded = errors.New("route changed by a configuration reload")
+	errWebSocketShutdown = errors.New("gateway is shutting down")
+)
+
+// websocketSession is a proxied WebSocket connection
+type websocketSession struct {
+	service string
+	target  string
+	path    string
+	cancel  context.CancelCauseFunc
+}
+
+// websocketRoute identifies the service and target a WebSocket route proxies to
+type websocketRoute struct {
+	service string
+	target  string
+}
+
+// websocketTracker keeps track of the WebSocket connections of every route,
+// so that route limits can be enforced and connections closed on reload and
+// shutdown
+type websocketTracker struct {
+	mu       sync.Mutex
+	sessions map[*websocketSession]struct{}
+	counts   map[string]int
+}
+
+// newWebSocketTracker creates a new websocketTracker
+func newWebSocketTracker() *websocketTracker {
+	return &websocketTracker{
+		sessions: make(map[*websocketSession]struct{}),
+		counts:   make(map[string]int),
+	}
+}
+
+// open registers a session, reporting false if the route already has the
+// maximum number of connections
+func (t *websocketTracker) open(session *websocketSession, maxConnections int) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if maxConnections > 0 && t.counts[session.path] >= maxConnections {
+		return false
+	}
+
+	t.sessions[session] = struct{}{}
+	t.counts[session.path]++
+	return true
+}
+
+// close unregisters a session
+func (t *websocketTracker) close(session *websocketSession) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, exists := t.sessions[session]; !exists {
+		return
+	}
+	delete(t.sessions, session)
+	t.counts[session.path]--
+	if t.counts[session.path] <= 0 {
+		delete(t.counts, session.path)
+	}
+}
+
+// CloseStale closes the connections of routes that are no longer configured
+// for WebSockets or now proxy to a different service or target, and returns
+// how many were closed
+func (t *websocketTracker) CloseStale(routes map[string]websocketRoute) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	closed := 0
+	for session := range t.sessions {
+		route, exists := routes[session.path]
+		if exists && route.service == session.service && route.target == session.target {
+			continue
+		}
+		session.cancel(errWebSocketReloaded)
+		closed++
+	}
+	return closed
+}
+
+// CloseAll closes every connection and returns how many were closed
+func (t *websocketTracker) CloseAll() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for session := range t.sessions {
+		session.cancel(errWebSocketShutdown)
+	}
+	return len(t.sessions)
+}
+
+// isWebSocketUpgrade reports whether the request asks to upgrade to WebSocket
+func isWebSocketUpgrade(r *http.Request) bool {
+	return httpguts.HeaderValuesContainsToken(r.Header["Connection"], "upgrade") &&
+		strings.EqualFold(r.Header.Get("Upgrade"), "websocket")
+}
+
+// serveWebSocket checks a WebSocket upgrade request against the route
+// settings and proxies the connection for as long as it stays open
+func (g *Gateway) serveWebSocket(w http.ResponseWriter, r *http.Request, proxy *ServiceProxy, service types.ServiceConfig, route types.Route, routerPath string) {
+	config := route.WebSocket
+
+	if !config.Enabled {
+		httpError(w, r, "WebSocket upgrades are not enabled for this route", http.StatusBadRequest)
+		return
+	}
+
+	if !originAllowed(r.Header.Get("Origin"), config.AllowedOrigins) {
+		httpError(w, r, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	if len(config.Subprotocols) > 0 {
+		filterSubprotocols(r.Header, config.Subprotocols)
+	}
+
+	ctx, cancel := context.WithCancelCause(r.Context())
+	defer cancel(nil)
+	if config.MaxLifetime > 0 {
+		var cancelLifetime context.CancelFunc
+		ctx, cancelLifetime = context.WithTimeoutCause(ctx, config.MaxLifetime.Std(), &timeoutError{phase: "websocket lifetime", timeout: config.MaxLifetime.Std()})
+		defer cancelLifetime()
+	}
+
+	session := &websocketSession{
+		service: service.Name,
+		target:  service.TargetURL,
+		path:    routerPath,
+		cancel:  cancel,
+	}
+	if !g.websockets.open(session, config.MaxConnections) {
+		httpError(w, r, "Too many WebSocket connections", http.StatusServiceUnavailable)
+		return
+	}
+	defer g.websockets.close(session)
+
+	// Only the connect timeout applies, the connection is bounded by the WebSocket timeouts instead
+	timeouts := types.UpstreamTimeouts{Connect: route.GetTimeouts(service).Connect}
+	r, release := withTimeouts(r.WithContext(ctx), 0, timeouts, false)
+	defer release()
+
+	ww := &websocketResponseWriter{ResponseWriter: w, idleTimeout: config.IdleTimeout.Std(), cancel: cancel}
+	proxy.ServeHTTP(ww, r, route)
+}
+
+// originAllowed reports whether a request origin is in the allowed list.
+// Requests without an origin come from non-browser clients and are allowed.
+func originAllowed(origin string, allowed []string) bool {
+	if len(allowed) == 0 || origin == "" {
+		return true
+	}
+
+	return slices.ContainsFunc(allowed, func(o string) bool {
+		return o == "*" || strings.EqualFold(o, origin)
+	})
+}
+
+// filterSubprotocols removes the requested subprotocols that are not allowed
+func filterSubprotocols(header http.Header, allowed []string) {
+	requested := header.Values("Sec-WebSocket-Protocol")
+	if len(requested) == 0 {
+		return
+	}
+
+	kept := make([]string, 0, len(requested))
+	for _, value := range requested {
+		for _, protocol := range strings.Split(value, ",") {
+			protocol = strings.TrimSpace(protocol)
+			if slices.Contains(allowed, protocol) {
+				kept = append(kept, protocol)
+			}
+		}
+	}
+
+	header.Del("Sec-WebSocket-Protocol")
+	if len(kept) > 0 {
+		header.Set("Sec-WebSocket-Protocol", strings.Join(kept, ", "))
+	}
+}
+
+// websocketResponseWriter hands out client connections that are closed when
+// they go idle for too long
+type websocketResponseWriter struct {
+	http.ResponseWriter
+	idleTimeout time.Duration
+	cancel      context.CancelCauseFunc
+}
+
+// Hijack takes over the client connection
+func (w *websocketResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, brw, err := http.NewResponseController(w.ResponseWriter).Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Deadlines of the HTTP server must not apply to the upgraded connection
+	_ = conn.SetDeadline(time.Time{})
+
+	if w.idleTimeout <= 0 {
+		return conn, brw, nil
+	}
+
+	timeout := w.idleTimeout
+	cancel := w.cancel
+	return &idleConn{
+		Conn:    conn,
+		timeout: timeout,
+		timer: time.AfterFunc(timeout, func() {
+			cancel(&timeoutError{phase: "websocket idle", timeout: timeout})
+		}),
+	}, brw, nil
+}
+
+// Unwrap returns the underlying http.ResponseWriter
+func (w *websocketResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// idleConn restarts its idle timer whenever data is read or written
+type idleConn struct {
+	net.Conn
+	timeout time.Duration
+	timer   *time.Timer
+}
+
+// Read reads from the connection and restarts the idle timer
+func (c *idleConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if n > 0 {
+		c.timer.Reset(c.timeout)
+	}
+	return n, err
+}
+
+// Write writes to the connection and restarts the idle timer
+func (c *idleConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	if n > 0 {
+		c.timer.Reset(c.timeout)
+	}
+	return n, err
+}
+
+// Close stops the idle timer and closes the connection
+func (c *idleConn) Close() error {
+	c.timer.Stop()
+	return c.Conn.Close()
+}
@@ -0,0 +1,180 @@
+package health
+
+import (
+	"AegisGate/pkg/types"
+	"sync"
+	"time"
+)
+
+// CircuitState represents the state of a target's circuit breaker
+type CircuitState string
+
+// Circuit breaker states
+const (
+	CircuitClosed   CircuitState = "closed"    // Requests flow normally
+	CircuitOpen     CircuitState = "open"      // Requests are rejected until the cooldown expires
+	CircuitHalfOpen CircuitState = "half-open" // A single trial request decides whether to close again
+)
+
+// Target tracks the passive health and circuit breaker state of an upstream target
+type Target struct {
+	name    string
+	address string
+
+	mu          sync.Mutex
+	breaker     bool // Failures never open the circuit when false
+	threshold   int
+	cooldown    time.Duration
+	drained     bool
+	state       CircuitState
+	failures    int
+	lastError   string
+	lastFailure time.Time
+	openedAt    time.Time
+	trialAt     time.Time
+}
+
+// Status is a point-in-time snapshot of a target
+type Status struct {
+	Name                string       `json:"name"`
+	Address             string       `json:"address"`
+	Healthy             bool         `json:"healthy"`
+	Drained             bool         `json:"drained"`
+	Circuit             CircuitState `json:"circuit"`
+	ConsecutiveFailures int          `json:"consecutive_failures"`
+	LastError           string       `json:"last_error,omitempty"`
+	LastFailure         *time.Time   `json:"last_failure,omitempty"`
+}
+
+// NewTarget creates a new Target with a closed circuit
+func NewTarget(name, address string, breaker types.CircuitBreakerConfig) *Target {
+	t := &Target{
+		name:    name,
+		address: address,
+		state:   CircuitClosed,
+	}
+	t.SetCircuitBreaker(breaker)
+	return t
+}
+
+// SetCircuitBreaker changes the circuit breaker settings of the target.
+// Disabling the circuit breaker closes the circuit.
+func (t *Target) SetCircuitBreaker(breaker types.CircuitBreakerConfig) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.breaker = breaker.Enabled
+	t.threshold = breaker.FailureThreshold
+	t.cooldown = breaker.Cooldown.Std()
+	if !t.breaker {
+		t.state = CircuitClosed
+	}
+}
+
+// Name returns the name of the target
+func (t *Target) Name() string {
+	return t.name
+}
+
+// Address returns the address of the target
+func (t *Target) Address() string {
+	return t.address
+}
+
+// Allow reports whether a new request may be sent to the target
+func (t *Target) Allow() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.drained {
+		return false
+	}
+
+	switch t.state {
+	case CircuitOpen:
+		if time.Since(t.openedAt) < t.cooldown {
+			return false
+		}
+		t.state = CircuitHalfOpen
+		t.trialAt = time.Now()
+		return true
+	case CircuitHalfOpen:
+		// Only one trial request is allowed while half-open, unless the
+		// previous trial never reported back within the cooldown
+		if time.Since(t.trialAt) < t.cooldown {
+			return false
+		}
+		t.trialAt = time.Now()
+		return true
+	default:
+		return true
+	}
+}
+
+// ReportSuccess records a successful request and closes the circuit
+func (t *Target) ReportSuccess() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.failures = 0
+	t.state = CircuitClosed
+}
+
+// ReportFailure records a failed request and opens the circuit once the
+// threshold is reached, if the circuit breaker is enabled
+func (t *Target) ReportFailure(err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.failures++
+	t.lastFailure = time.Now()
+	if err != nil {
+		t.lastError = err.Error()
+	}
+
+	if t.breaker && (t.state == CircuitHalfOpen || t.failures >= t.threshold) {
+		t.state = CircuitOpen
+		t.openedAt = t.lastFailure
+	}
+}
+
+// SetDrained marks the target as drained, so that it receives no new requests
+func (t *Target) SetDrained(drained bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.drained = drained
+}
+
+// Healthy reports whether the target is able to serve requests
+func (t *Target) Healthy() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.healthy()
+}
+
+// healthy reports the health of the target, the caller must hold the lock
+func (t *Target) healthy() bool {
+	return !t.drained && t.state != CircuitOpen
+}
+
+// Status returns a snapshot of the target state
+func (t *Target) Status() Status {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	status := Status{
+		Name:                t.name,
+		Address:             t.address,
+		Healthy:             t.healthy(),
+		Drained:             t.drained,
+		Circuit:             t.state,
+		ConsecutiveFailures: t.failures,
+		LastError:           t.lastError,
+	}
+	if !t.lastFailure.IsZero() {
+		lastFailure := t.lastFailure
+		status.LastFailure = &lastFailure
+	}
+
+	return status
+}
@@ -1,21 +1,32 @@
 package logger
 
 import (
+	"AegisGate/pkg/types"
+	"bufio"
 	"log"
+	"net"
 	"net/http"
-	"net/http/httputil"
 	"time"
 )
 
 // Logger represents the logging configuration
 type Logger struct {
-	debug bool
+	debug    bool
+	redactor *Redactor
 }
 
-// New creates a new Logger instance
+// New creates a new Logger instance that applies the default redaction to request dumps
 func New(debug bool) *Logger {
+	// The default configuration holds no patterns, so it cannot fail
+	redactor, _ := NewRedactor(types.DebugDumpConfig{})
+	return NewWithRedactor(debug, redactor)
+}
+
+// NewWithRedactor creates a new Logger instance that redacts request dumps with the given Redactor
+func NewWithRedactor(debug bool, redactor *Redactor) *Logger {
 	return &Logger{
-		debug: debug,
+		debug:    debug,
+		redactor: redactor,
 	}
 }
 
@@ -71,6 +82,37 @@ func (rw *ResponseWriter) Write(b []byte) (int, error) {
 	return size, err
 }
 
+// StatusCode returns the status code of the response
+func (rw *ResponseWriter) StatusCode() int {
+	return rw.statusCode
+}
+
+// GRPCStatus returns the gRPC status of the response, sent either as a header
+// of a trailers-only response or as a trailer, or an empty string for
+// responses that are not gRPC
+func (rw *ResponseWriter) GRPCStatus() string {
+	h := rw.Header()
+	if status := h.Get("Grpc-Status"); status != "" {
+		return status
+	}
+	return h.Get(http.TrailerPrefix + "Grpc-Status")
+}
+
+// Flush sends any buffered data to the client, as needed for streaming responses
+func (rw *ResponseWriter) Flush() {
+	_ = http.NewResponseController(rw.ResponseWriter).Flush()
+}
+
+// Hijack lets the caller take over the connection, as needed for WebSocket upgrades
+func (rw *ResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(rw.ResponseWriter).Hijack()
+}
+
+// Unwrap returns the underlying http.ResponseWriter
+func (rw *ResponseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
 // RequestLogger handles request logging
 type RequestLogger struct {
 	logger      *Logger
@@ -89,9 +131,12 @@ func NewRequestLogger(logger *Logger, serviceName string) *RequestLogger {
 func (rl *RequestLogger) LogRequest(r *http.Request) {
 	rl.logger.ServiceDebug(rl.serviceName, "Incoming request: %s %s", r.Method, r.URL.Path)
 	if rl.logger.debug {
-		if dump, err := httputil.DumpRequest(r, true); err == nil {
-			rl.logger.ServiceDebug(rl.serviceName, "Request details:\n%s", string(dump))
+		dump, err := rl.logger.redactor.DumpRequest(r)
+		if err != nil {
+			rl.logger.ServiceDebug(rl.serviceName, "Failed to dump request: %v", err)
+			return
 		}
+		rl.logger.ServiceDebug(rl.serviceName, "Request details:\n%s", dump)
 	}
 }
 
@@ -103,6 +148,19 @@ func (rl *RequestLogger) LogPathStripped(originalPath, newPath string) {
 // LogCompleted logs the completed request details
 func (rl *RequestLogger) LogCompleted(r *http.Request, rw *ResponseWriter, targetURL string, start time.Time) {
 	duration := time.Since(start)
+	if status := rw.GRPCStatus(); status != "" {
+		rl.logger.ServiceDebug(rl.serviceName,
+			"Completed %s %s -> %s [%d] grpc-status=%s (%d bytes) in %v",
+			r.Method,
+			r.URL.Path,
+			targetURL,
+			rw.statusCode,
+			status,
+			rw.size,
+			duration,
+		)
+		return
+	}
 	rl.logger.ServiceDebug(rl.serviceName,
 		"Completed %s %s -> %s [%d] (%d bytes) in %v",
 		r.Method,
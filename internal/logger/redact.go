@@ -0,0 +1,344 @@
+package logger
+
+import (
+	"AegisGate/pkg/types"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/http/httputil"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// redactedValue replaces any value removed from a request dump
+const redactedValue = "[REDACTED]"
+
+// defaultMaxDumpBodySize is used when no body size cap is configured
+const defaultMaxDumpBodySize = 4 * types.Kilobyte
+
+// defaultRedactHeaders are always masked in request dumps
+var defaultRedactHeaders = []string{
+	"Authorization",
+	"Proxy-Authorization",
+	"Cookie",
+	"Set-Cookie",
+	"X-Api-Key",
+}
+
+// defaultSkipContentTypes are content type prefixes of binary payloads that are never dumped
+var defaultSkipContentTypes = []string{
+	"application/octet-stream",
+	"application/pdf",
+	"application/zip",
+	"application/gzip",
+	"application/grpc",
+	"multipart/form-data",
+	"image/",
+	"audio/",
+	"video/",
+	"font/",
+}
+
+// Redactor removes sensitive data from request dumps
+type Redactor struct {
+	headers      map[string]bool
+	jsonFields   [][]string
+	patterns     []*regexp.Regexp
+	maxBodySize  int64
+	skipPrefixes []string
+}
+
+// NewRedactor creates a new Redactor from the debug dump configuration
+func NewRedactor(config types.DebugDumpConfig) (*Redactor, error) {
+	rd := &Redactor{
+		headers:      make(map[string]bool),
+		maxBodySize:  int64(config.MaxBodySize),
+		skipPrefixes: append([]string{}, defaultSkipContentTypes...),
+	}
+
+	if rd.maxBodySize == 0 {
+		rd.maxBodySize = int64(defaultMaxDumpBodySize)
+	}
+
+	for _, name := range append(defaultRedactHeaders, config.RedactHeaders...) {
+		rd.headers[http.CanonicalHeaderKey(name)] = true
+	}
+
+	for _, field := range config.RedactJSONFields {
+		rd.jsonFields = append(rd.jsonFields, strings.Split(field, "."))
+	}
+
+	for _, pattern := range config.RedactPatterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redact pattern '%s': %w", pattern, err)
+		}
+		rd.patterns = append(rd.patterns, re)
+	}
+
+	for _, contentType := range config.SkipContentTypes {
+		rd.skipPrefixes = append(rd.skipPrefixes, strings.ToLower(contentType))
+	}
+
+	return rd, nil
+}
+
+// DumpRequest returns a redacted dump of the request. At most the configured
+// number of body bytes is read, and the request body is left intact for the
+// handlers that run after the dump.
+func (rd *Redactor) DumpRequest(r *http.Request) (string, error) {
+	header := r.Header.Clone()
+	for name := range header {
+		if rd.headers[name] {
+			header[name] = []string{redactedValue}
+		}
+	}
+
+	headOnly := *r
+	headOnly.Header = header
+	headOnly.Body = nil
+	head, err := httputil.DumpRequest(&headOnly, false)
+	if err != nil {
+		return "", err
+	}
+
+	body, err := rd.dumpBody(r)
+	if err != nil {
+		return "", err
+	}
+
+	return rd.redactPatterns(string(head) + body), nil
+}
+
+// dumpBody reads up to the body size cap and returns the printable body
+func (rd *Redactor) dumpBody(r *http.Request) (string, error) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return "", nil
+	}
+
+	contentType := r.Header.Get("Content-Type")
+	if rd.skipContentType(contentType) {
+		return fmt.Sprintf("[body omitted: content type %s]", contentType), nil
+	}
+
+	buf, err := io.ReadAll(io.LimitReader(r.Body, rd.maxBodySize+1))
+	r.Body = &replayBody{Reader: io.MultiReader(bytes.NewReader(buf), r.Body), Closer: r.Body}
+	if err != nil {
+		return "", fmt.Errorf("failed to read request body: %w", err)
+	}
+
+	truncated := int64(len(buf)) > rd.maxBodySize
+	if truncated {
+		buf = buf[:rd.maxBodySize]
+	}
+
+	// JSON bodies that cannot be redacted are never dumped as they are
+	if len(rd.jsonFields) > 0 && isJSON(contentType) {
+		redacted, ok := rd.redactJSON(buf, truncated)
+		if !ok {
+			return "[body omitted: invalid JSON]", nil
+		}
+		buf = redacted
+	}
+
+	body := string(buf)
+	if truncated {
+		body += fmt.Sprintf("\n[body truncated after %d bytes]", rd.maxBodySize)
+	}
+
+	return body, nil
+}
+
+// skipContentType reports whether bodies of the given content type must not be dumped
+func (rd *Redactor) skipContentType(contentType string) bool {
+	contentType = strings.ToLower(contentType)
+	for _, prefix := range rd.skipPrefixes {
+		if strings.HasPrefix(contentType, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactJSON masks the configured field paths in a JSON document. Documents
+// cut off at the body size cap are masked token by token. It reports false
+// for bodies that are not valid JSON.
+func (rd *Redactor) redactJSON(body []byte, truncated bool) ([]byte, bool) {
+	var doc interface{}
+	if truncated || json.Unmarshal(body, &doc) != nil {
+		return rd.maskJSONFields(body)
+	}
+
+	for _, path := range rd.jsonFields {
+		redactJSONPath(doc, path)
+	}
+
+	redacted, err := json.Marshal(doc)
+	if err != nil {
+		return nil, false
+	}
+	return redacted, true
+}
+
+// jsonContainer is an object or array being scanned by maskJSONFields
+type jsonContainer struct {
+	object    bool
+	prefix    []string // Field path of the container, arrays share the path of their field
+	key       string   // Field whose value is being scanned
+	expectKey bool
+}
+
+// maskJSONFields masks the values of the configured field paths in a JSON
+// document that may end early, scanning its tokens. A value cut off by the end
+// of the document is masked up to the end. It reports false if the document
+// has a syntax error.
+func (rd *Redactor) maskJSONFields(body []byte) ([]byte, bool) {
+	type span struct{ start, end int64 }
+	var spans []span
+	var stack []*jsonContainer
+
+	dec := json.NewDecoder(bytes.NewReader(body))
+scan:
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			var syntaxErr *json.SyntaxError
+			if errors.As(err, &syntaxErr) {
+				return nil, false
+			}
+			break // The document ended, possibly early
+		}
+
+		var top *jsonContainer
+		if len(stack) > 0 {
+			top = stack[len(stack)-1]
+		}
+
+		// Field names are followed by their value
+		if key, ok := tok.(string); ok && top != nil && top.object && top.expectKey {
+			top.key, top.expectKey = key, false
+			if !rd.redactsField(append(slices.Clip(top.prefix), key)) {
+				continue
+			}
+
+			start := dec.InputOffset()
+			if !skipJSONValue(dec) {
+				spans = append(spans, span{start, int64(len(body))})
+				break scan
+			}
+			spans = append(spans, span{start, dec.InputOffset()})
+			top.expectKey = true
+			continue
+		}
+
+		switch tok {
+		case json.Delim('{'), json.Delim('['):
+			var prefix []string
+			if top != nil {
+				prefix = top.prefix
+				if top.object {
+					prefix = append(slices.Clip(prefix), top.key)
+				}
+			}
+			stack = append(stack, &jsonContainer{object: tok == json.Delim('{'), prefix: prefix, expectKey: tok == json.Delim('{')})
+			continue
+		case json.Delim('}'), json.Delim(']'):
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+		}
+
+		// A value completed, so objects expect the next field name
+		if len(stack) > 0 && stack[len(stack)-1].object {
+			stack[len(stack)-1].expectKey = true
+		}
+	}
+
+	masked := make([]byte, 0, len(body))
+	offset := int64(0)
+	for _, s := range spans {
+		masked = append(masked, body[offset:s.start]...)
+		masked = append(masked, `:"`+redactedValue+`"`...)
+		offset = s.end
+	}
+	return append(masked, body[offset:]...), true
+}
+
+// skipJSONValue consumes the next value of a JSON document and reports
+// whether it was complete
+func skipJSONValue(dec *json.Decoder) bool {
+	depth := 0
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return false
+		}
+		switch tok {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
+		if depth == 0 {
+			return true
+		}
+	}
+}
+
+// redactsField reports whether the value at a field path is masked
+func (rd *Redactor) redactsField(path []string) bool {
+	for _, field := range rd.jsonFields {
+		if slices.Equal(field, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactJSONPath masks the value at path, descending into every element of arrays
+func redactJSONPath(node interface{}, path []string) {
+	switch v := node.(type) {
+	case []interface{}:
+		for _, item := range v {
+			redactJSONPath(item, path)
+		}
+	case map[string]interface{}:
+		child, ok := v[path[0]]
+		if !ok {
+			return
+		}
+		if len(path) == 1 {
+			v[path[0]] = redactedValue
+			return
+		}
+		redactJSONPath(child, path[1:])
+	}
+}
+
+// redactPatterns masks every match of the configured patterns
+func (rd *Redactor) redactPatterns(s string) string {
+	for _, re := range rd.patterns {
+		s = re.ReplaceAllString(s, redactedValue)
+	}
+	return s
+}
+
+// isJSON reports whether the content type denotes a JSON document
+func isJSON(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// replayBody serves the bytes consumed by a dump before the rest of the original body
+type replayBody struct {
+	io.Reader
+	io.Closer
+}
@@ -0,0 +1,143 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// defaultRegistry holds the metrics created with NewCounter
+var defaultRegistry = &Registry{}
+
+// Registry holds a set of metrics and writes them in the Prometheus text format
+type Registry struct {
+	mu       sync.Mutex
+	counters []*Counter
+}
+
+// Counter is a monotonically increasing value for every combination of label values
+type Counter struct {
+	name   string
+	help   string
+	labels []string
+	mu     sync.Mutex
+	values map[string]*counterValue
+}
+
+// counterValue is the value of a counter for one combination of label values
+type counterValue struct {
+	labelValues []string
+	value       float64
+}
+
+// NewCounter creates a counter and registers it with the default registry
+func NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{
+		name:   name,
+		help:   help,
+		labels: labels,
+		values: make(map[string]*counterValue),
+	}
+	defaultRegistry.Register(c)
+	return c
+}
+
+// Register adds a counter to the registry
+func (r *Registry) Register(c *Counter) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.counters = append(r.counters, c)
+}
+
+// Inc increments the counter for the given label values by one
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add increments the counter for the given label values
+func (c *Counter) Add(delta float64, labelValues ...string) {
+	key := strings.Join(labelValues, "\xff")
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	value, exists := c.values[key]
+	if !exists {
+		value = &counterValue{labelValues: append([]string(nil), labelValues...)}
+		c.values[key] = value
+	}
+	value.value += delta
+}
+
+// Value returns the value of the counter for the given label values
+func (c *Counter) Value(labelValues ...string) float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if value, exists := c.values[strings.Join(labelValues, "\xff")]; exists {
+		return value.value
+	}
+	return 0
+}
+
+// WriteText writes all metrics of the default registry in the Prometheus text format
+func WriteText(w io.Writer) error {
+	return defaultRegistry.WriteText(w)
+}
+
+// WriteText writes all metrics in the Prometheus text format
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.Lock()
+	counters := append([]*Counter(nil), r.counters...)
+	r.mu.Unlock()
+
+	for _, c := range counters {
+		if err := c.writeText(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeText writes the counter in the Prometheus text format, ordered by label values
+func (c *Counter) writeText(w io.Writer) error {
+	c.mu.Lock()
+	values := make([]counterValue, 0, len(c.values))
+	for _, value := range c.values {
+		values = append(values, *value)
+	}
+	c.mu.Unlock()
+
+	sort.Slice(values, func(i, j int) bool {
+		return strings.Join(values[i].labelValues, "\xff") < strings.Join(values[j].labelValues, "\xff")
+	})
+
+	if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", c.name, c.help, c.name); err != nil {
+		return err
+	}
+	for _, value := range values {
+		if _, err := fmt.Fprintf(w, "%s%s %g\n", c.name, c.formatLabels(value.labelValues), value.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// formatLabels formats label values as a Prometheus label set
+func (c *Counter) formatLabels(labelValues []string) string {
+	if len(c.labels) == 0 {
+		return ""
+	}
+
+	pairs := make([]string, len(c.labels))
+	for i, label := range c.labels {
+		value := ""
+		if i < len(labelValues) {
+			value = labelValues[i]
+		}
+		pairs[i] = fmt.Sprintf("%s=%q", label, value)
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
@@ -0,0 +1,456 @@
+package upgrade
+
+import (
+	"AegisGate/internal/logger"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Environment variables used to pass listeners to a new process
+const (
+	envListenFDs   = "AEGISGATE_LISTEN_FDS" // Comma separated names of the inherited listeners, in descriptor order
+	envReadyFD     = "AEGISGATE_READY_FD"   // Descriptor the new process writes to once it is ready
+	envSystemdFDs  = "LISTEN_FDS"
+	envSystemdPID  = "LISTEN_PID"
+	envSystemdName = "LISTEN_FDNAMES"
+)
+
+// listenFDsStart is the first inherited file descriptor, following stdin, stdout and stderr
+const listenFDsStart = 3
+
+// filer is implemented by listeners whose file descriptor can be passed to another process
+type filer interface {
+	File() (*os.File, error)
+}
+
+// Upgrader hands listening sockets over to a new process so that the binary
+// can be replaced without dropping connections. It also picks up listeners
+// passed in by systemd socket activation. Besides TCP listeners, the UDP
+// sockets of HTTP/3 listeners are handed over as packet connections.
+type Upgrader struct {
+	mu               sync.Mutex
+	inherited        map[string]net.Listener
+	inheritedPackets map[string]net.PacketConn
+	listeners        map[string]net.Listener
+	packetConns      map[string]net.PacketConn
+	readyFile        *os.File
+	upgrading        bool
+	logger           *logger.Logger
+}
+
+// New creates a new Upgrader and takes over any listeners inherited from a
+// parent process or from systemd
+func New(l *logger.Logger) (*Upgrader, error) {
+	u := &Upgrader{
+		inherited:        make(map[string]net.Listener),
+		inheritedPackets: make(map[string]net.PacketConn),
+		listeners:        make(map[string]net.Listener),
+		packetConns:      make(map[string]net.PacketConn),
+		logger:           l,
+	}
+
+	if err := u.inheritFromParent(); err != nil {
+		return nil, err
+	}
+
+	if err := u.inheritFromSystemd(); err != nil {
+		return nil, err
+	}
+
+	return u, nil
+}
+
+// inheritFromParent takes over the listeners passed by a gateway process that is being upgraded
+func (u *Upgrader) inheritFromParent() error {
+	names := os.Getenv(envListenFDs)
+	readyFD := os.Getenv(envReadyFD)
+	_ = os.Unsetenv(envListenFDs)
+	_ = os.Unsetenv(envReadyFD)
+
+	if names == "" {
+		return nil
+	}
+
+	if err := u.inheritListeners(strings.Split(names, ",")); err != nil {
+		return err
+	}
+
+	fd, err := strconv.Atoi(readyFD)
+	if err != nil {
+		return fmt.Errorf("invalid %s: %s", envReadyFD, readyFD)
+	}
+	u.readyFile = os.NewFile(uintptr(fd), "ready")
+
+	u.logger.Info("Inherited %d listeners from parent process %d", len(u.inherited)+len(u.inheritedPackets), os.Getppid())
+	return nil
+}
+
+// inheritFromSystemd takes over the listeners passed by systemd socket activation
+func (u *Upgrader) inheritFromSystemd() error {
+	count := os.Getenv(envSystemdFDs)
+	pid := os.Getenv(envSystemdPID)
+	names := os.Getenv(envSystemdName)
+	_ = os.Unsetenv(envSystemdFDs)
+	_ = os.Unsetenv(envSystemdPID)
+	_ = os.Unsetenv(envSystemdName)
+
+	if count == "" || pid != strconv.Itoa(os.Getpid()) {
+		return nil
+	}
+
+	n, err := strconv.Atoi(count)
+	if err != nil {
+		return fmt.Errorf("invalid %s: %s", envSystemdFDs, count)
+	}
+
+	fdNames := make([]string, n)
+	if names != "" {
+		copy(fdNames, strings.Split(names, ":"))
+	}
+
+	if err := u.inheritListeners(fdNames); err != nil {
+		return err
+	}
+
+	u.logger.Info("Inherited %d listeners from systemd socket activation", n)
+	return nil
+}
+
+// inheritListeners creates listeners from the inherited file descriptors,
+// and packet connections from those that do not accept connections.
+// Listeners without a name are keyed by their address.
+func (u *Upgrader) inheritListeners(names []string) error {
+	for i, name := range names {
+		file := os.NewFile(uintptr(listenFDsStart+i), name)
+		ln, err := net.FileListener(file)
+		if err != nil {
+			pc, pcErr := net.FilePacketConn(file)
+			_ = file.Close()
+			if pcErr != nil {
+				return fmt.Errorf("failed to inherit listener %d: %w", i, err)
+			}
+
+			if name == "" || name == "unknown" {
+				name = pc.LocalAddr().String()
+			}
+			u.inheritedPackets[name] = pc
+			continue
+		}
+		_ = file.Close()
+
+		if name == "" || name == "unknown" {
+			name = ln.Addr().String()
+		}
+		u.inherited[name] = ln
+	}
+
+	return nil
+}
+
+// Listen returns the inherited listener with the given name or address, or
+// creates a new one. The listener is handed over to the new process on upgrade.
+func (u *Upgrader) Listen(name, network, address string) (net.Listener, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	ln := u.takeInherited(name, network, address)
+	if ln != nil {
+		u.logger.Debug("Using inherited listener %s on %s", name, ln.Addr())
+	} else {
+		var err error
+		ln, err = net.Listen(network, address)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	u.listeners[name] = ln
+	return ln, nil
+}
+
+// ListenPacket returns the inherited packet connection with the given name or
+// address, or creates a new one. The connection is handed over to the new
+// process on upgrade.
+func (u *Upgrader) ListenPacket(name, network, address string) (net.PacketConn, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	pc := u.takeInheritedPacket(name, network, address)
+	if pc != nil {
+		u.logger.Debug("Using inherited packet listener %s on %s", name, pc.LocalAddr())
+	} else {
+		var err error
+		pc, err = net.ListenPacket(network, address)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	u.packetConns[name] = pc
+	return pc, nil
+}
+
+// takeInherited removes and returns the inherited listener matching the name or address
+func (u *Upgrader) takeInherited(name, network, address string) net.Listener {
+	if ln, ok := u.inherited[name]; ok {
+		delete(u.inherited, name)
+		return ln
+	}
+
+	for key, ln := range u.inherited {
+		if sameAddress(ln.Addr(), network, address) {
+			delete(u.inherited, key)
+			return ln
+		}
+	}
+
+	return nil
+}
+
+// takeInheritedPacket removes and returns the inherited packet connection matching the name or address
+func (u *Upgrader) takeInheritedPacket(name, network, address string) net.PacketConn {
+	if pc, ok := u.inheritedPackets[name]; ok {
+		delete(u.inheritedPackets, name)
+		return pc
+	}
+
+	for key, pc := range u.inheritedPackets {
+		if sameAddress(pc.LocalAddr(), network, address) {
+			delete(u.inheritedPackets, key)
+			return pc
+		}
+	}
+
+	return nil
+}
+
+// sameAddress reports whether a listener address matches the requested one
+func sameAddress(addr net.Addr, network, address string) bool {
+	if addr.String() == address {
+		return true
+	}
+
+	var ip, requestedIP net.IP
+	var port, requestedPort int
+	switch a := addr.(type) {
+	case *net.TCPAddr:
+		requested, err := net.ResolveTCPAddr(network, address)
+		if err != nil {
+			return false
+		}
+		ip, port, requestedIP, requestedPort = a.IP, a.Port, requested.IP, requested.Port
+	case *net.UDPAddr:
+		requested, err := net.ResolveUDPAddr(network, address)
+		if err != nil {
+			return false
+		}
+		ip, port, requestedIP, requestedPort = a.IP, a.Port, requested.IP, requested.Port
+	default:
+		return false
+	}
+
+	return port == requestedPort &&
+		(ip.Equal(requestedIP) || (ip.IsUnspecified() && requestedIP == nil))
+}
+
+// Ready closes inherited listeners that were not claimed and tells the parent
+// process, if any, that this process is serving and the parent may exit
+func (u *Upgrader) Ready() error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	for name, ln := range u.inherited {
+		u.logger.Info("Closing unused inherited listener %s", name)
+		_ = ln.Close()
+	}
+	u.inherited = make(map[string]net.Listener)
+	for name, pc := range u.inheritedPackets {
+		u.logger.Info("Closing unused inherited packet listener %s", name)
+		_ = pc.Close()
+	}
+	u.inheritedPackets = make(map[string]net.PacketConn)
+
+	if u.readyFile == nil {
+		return nil
+	}
+
+	// The parent no longer removes the socket files it handed over, so this
+	// process does once it is serving on them
+	for _, ln := range u.listeners {
+		if ul, ok := ln.(*net.UnixListener); ok {
+			ul.SetUnlinkOnClose(true)
+		}
+	}
+
+	defer func() {
+		_ = u.readyFile.Close()
+		u.readyFile = nil
+	}()
+	if _, err := u.readyFile.Write([]byte{1}); err != nil {
+		return fmt.Errorf("failed to notify parent process: %w", err)
+	}
+	return nil
+}
+
+// Upgrade starts a new process from the executable the gateway was started
+// with, passes it the listening sockets and waits until it is ready or ctx is
+// done. On success the caller is expected to drain and exit.
+func (u *Upgrader) Upgrade(ctx context.Context) error {
+	u.mu.Lock()
+	if u.upgrading {
+		u.mu.Unlock()
+		return fmt.Errorf("an upgrade is already in progress")
+	}
+	u.upgrading = true
+	u.mu.Unlock()
+
+	err := u.startChild(ctx)
+
+	u.mu.Lock()
+	u.upgrading = false
+	u.mu.Unlock()
+
+	return err
+}
+
+// startChild execs the new process with the listener files and waits for it to become ready
+func (u *Upgrader) startChild(ctx context.Context) error {
+	names, files, err := u.listenerFiles()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		for _, file := range files {
+			_ = file.Close()
+		}
+	}()
+
+	readyR, readyW, err := os.Pipe()
+	if err != nil {
+		return fmt.Errorf("failed to create readiness pipe: %w", err)
+	}
+	defer readyR.Close()
+
+	executable, err := exec.LookPath(os.Args[0])
+	if err != nil {
+		_ = readyW.Close()
+		return fmt.Errorf("failed to find executable: %w", err)
+	}
+
+	cmd := exec.Command(executable, os.Args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.ExtraFiles = append(files, readyW)
+	cmd.Env = append(childEnv(),
+		envListenFDs+"="+strings.Join(names, ","),
+		envReadyFD+"="+strconv.Itoa(listenFDsStart+len(files)),
+	)
+
+	u.logger.Info("Starting new process %s to take over %d listeners", executable, len(files))
+	err = cmd.Start()
+	_ = readyW.Close()
+	if err != nil {
+		return fmt.Errorf("failed to start new process: %w", err)
+	}
+
+	exited := make(chan error, 1)
+	go func() {
+		exited <- cmd.Wait()
+	}()
+
+	ready := make(chan error, 1)
+	go func() {
+		buf := make([]byte, 1)
+		_, err := readyR.Read(buf)
+		ready <- err
+	}()
+
+	select {
+	case err := <-ready:
+		if err != nil {
+			// The pipe closes without data when the new process exits early
+			_ = cmd.Process.Kill()
+			return fmt.Errorf("new process failed to become ready: %w", err)
+		}
+		u.logger.Info("New process %d is ready", cmd.Process.Pid)
+		return nil
+	case err := <-exited:
+		return fmt.Errorf("new process exited before becoming ready: %v", err)
+	case <-ctx.Done():
+		_ = cmd.Process.Kill()
+		return fmt.Errorf("new process did not become ready: %w", ctx.Err())
+	}
+}
+
+// listenerFiles returns duplicates of the listener and packet connection file
+// descriptors, ordered by name
+func (u *Upgrader) listenerFiles() ([]string, []*os.File, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	sockets := make(map[string]any, len(u.listeners)+len(u.packetConns))
+	for name, ln := range u.listeners {
+		sockets[name] = ln
+	}
+	for name, pc := range u.packetConns {
+		sockets[name] = pc
+	}
+
+	names := make([]string, 0, len(sockets))
+	for name := range sockets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	files := make([]*os.File, 0, len(names))
+	for _, name := range names {
+		// The new process serves on the socket files from now on, so closing
+		// the listeners here must not remove them
+		if ul, ok := sockets[name].(*net.UnixListener); ok {
+			ul.SetUnlinkOnClose(false)
+		}
+
+		ln, ok := sockets[name].(filer)
+		if !ok {
+			closeFiles(files)
+			return nil, nil, fmt.Errorf("listener %s cannot be passed to another process", name)
+		}
+		file, err := ln.File()
+		if err != nil {
+			closeFiles(files)
+			return nil, nil, fmt.Errorf("failed to get file of listener %s: %w", name, err)
+		}
+		files = append(files, file)
+	}
+
+	return names, files, nil
+}
+
+// closeFiles closes all files
+func closeFiles(files []*os.File) {
+	for _, file := range files {
+		_ = file.Close()
+	}
+}
+
+// childEnv returns the environment of this process without the listener variables
+func childEnv() []string {
+	env := make([]string, 0, len(os.Environ()))
+	for _, kv := range os.Environ() {
+		key, _, _ := strings.Cut(kv, "=")
+		switch key {
+		case envListenFDs, envReadyFD, envSystemdFDs, envSystemdPID, envSystemdName:
+			continue
+		}
+		env = append(env, kv)
+	}
+	return env
+}
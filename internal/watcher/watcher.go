@@ -4,19 +4,32 @@ import (
 	"AegisGate/internal/config"
 	"AegisGate/internal/logger"
 	"AegisGate/pkg/types"
+	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
 	"sync"
+	"time"
 
 	"github.com/fsnotify/fsnotify"
 )
 
+// kubernetesDataDir is the symlink Kubernetes swaps atomically when a mounted ConfigMap changes
+const kubernetesDataDir = "..data"
+
 // ConfigWatcher watches for configuration file changes
 type ConfigWatcher struct {
-	watcher    *fsnotify.Watcher
-	logger     *logger.Logger
-	configPath string
-	mu         sync.RWMutex
-	handlers   []ConfigChangeHandler
+	watcher      *fsnotify.Watcher
+	logger       *logger.Logger
+	configPath   string
+	resolvedPath string
+	watchedDirs  map[string]bool
+	debounce     time.Duration
+	mu           sync.RWMutex
+	reloadMu     sync.Mutex
+	handlers     []ConfigChangeHandler
+	history      *config.History
+	pinnedHash   string // Hash of the file when the current rollback was applied
 }
 
 // ConfigChangeHandler is called when configuration changes
@@ -24,19 +37,37 @@ type ConfigChangeHandler interface {
 	OnConfigChange(newConfig *types.Config) error
 }
 
-// New creates a new ConfigWatcher
-func New(configPath string, logger *logger.Logger) (*ConfigWatcher, error) {
-	watcher, err := fsnotify.NewWatcher()
+// New creates a new ConfigWatcher. The initial configuration and the hash of
+// the file it was loaded from are recorded as the first version. Unless file
+// watching is disabled, changes to the file are reloaded automatically.
+func New(configPath string, initial *types.Config, hash string, logger *logger.Logger) (*ConfigWatcher, error) {
+	absPath, err := filepath.Abs(configPath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create watcher: %w", err)
+		return nil, fmt.Errorf("failed to resolve config path: %w", err)
 	}
 
 	cw := &ConfigWatcher{
-		watcher:    watcher,
-		logger:     logger,
-		configPath: configPath,
-		handlers:   make([]ConfigChangeHandler, 0),
+		logger:      logger,
+		configPath:  absPath,
+		watchedDirs: make(map[string]bool),
+		debounce:    initial.Reload.Debounce.Std(),
+		handlers:    make([]ConfigChangeHandler, 0),
+		history:     config.NewHistory(),
+	}
+
+	version := cw.history.Record(initial, hash, "startup", 0)
+	cw.logger.Info("Configuration version %d applied (hash %s)", version.Number, shortHash(version.Hash))
+
+	if initial.Reload.DisableWatch {
+		cw.logger.Info("Config file watching disabled, reload with SIGHUP or the admin API")
+		return cw, nil
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create watcher: %w", err)
 	}
+	cw.watcher = watcher
 
 	if err := cw.watch(); err != nil {
 		return nil, err
@@ -52,29 +83,79 @@ func (cw *ConfigWatcher) RegisterHandler(handler ConfigChangeHandler) {
 	cw.handlers = append(cw.handlers, handler)
 }
 
-// watch starts watching the configuration file
+// watch starts watching the configuration file. The directories containing
+// the file are watched rather than the file itself, because editors and
+// Kubernetes replace the file instead of writing to it, which ends a watch
+// on the file.
 func (cw *ConfigWatcher) watch() error {
-	if err := cw.watcher.Add(cw.configPath); err != nil {
-		return fmt.Errorf("failed to watch config file: %w", err)
+	if err := cw.watcher.Add(filepath.Dir(cw.configPath)); err != nil {
+		return fmt.Errorf("failed to watch config directory: %w", err)
 	}
+	cw.watchedDirs[filepath.Dir(cw.configPath)] = true
+
+	cw.resolveSymlinks()
 
 	go cw.watchLoop()
 	return nil
 }
 
-// watchLoop handles file system events
+// resolveSymlinks follows the config path through any symlinks and watches
+// the directory of the file it currently points to
+func (cw *ConfigWatcher) resolveSymlinks() {
+	resolved, err := filepath.EvalSymlinks(cw.configPath)
+	if err != nil {
+		// The file may be missing for a moment while it is being replaced
+		cw.logger.Debug("Failed to resolve config path: %v", err)
+		return
+	}
+	cw.resolvedPath = resolved
+
+	dir := filepath.Dir(resolved)
+	if cw.watchedDirs[dir] {
+		return
+	}
+	if err := cw.watcher.Add(dir); err != nil {
+		cw.logger.Error("Failed to watch config directory %s: %v", dir, err)
+		return
+	}
+	cw.watchedDirs[dir] = true
+	cw.logger.Debug("Watching config directory %s", dir)
+}
+
+// isConfigEvent reports whether a file system event may have changed the configuration
+func (cw *ConfigWatcher) isConfigEvent(event fsnotify.Event) bool {
+	if event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename|fsnotify.Remove) == 0 {
+		return false
+	}
+
+	return event.Name == cw.configPath ||
+		event.Name == cw.resolvedPath ||
+		filepath.Base(event.Name) == kubernetesDataDir
+}
+
+// watchLoop handles file system events. Bursts of events, such as those
+// caused by an atomic save, are debounced into a single reload.
 func (cw *ConfigWatcher) watchLoop() {
+	timer := time.NewTimer(cw.debounce)
+	timer.Stop()
+
 	for {
 		select {
 		case event, ok := <-cw.watcher.Events:
 			if !ok {
+				timer.Stop()
 				return
 			}
-			if event.Op&fsnotify.Write == fsnotify.Write {
-				cw.handleConfigChange()
+			if cw.isConfigEvent(event) {
+				cw.logger.Debug("Config watcher event: %s", event)
+				timer.Reset(cw.debounce)
 			}
+		case <-timer.C:
+			cw.resolveSymlinks()
+			cw.handleConfigChange()
 		case err, ok := <-cw.watcher.Errors:
 			if !ok {
+				timer.Stop()
 				return
 			}
 			cw.logger.Error("Config watcher error: %v", err)
@@ -84,30 +165,137 @@ func (cw *ConfigWatcher) watchLoop() {
 
 // handleConfigChange processes configuration changes
 func (cw *ConfigWatcher) handleConfigChange() {
+	cw.logger.Debug("Configuration file changed, checking for changes...")
+
+	if err := cw.Reload(); err != nil {
+		cw.logger.Error("%v", err)
+	}
+}
+
+// Reload loads the configuration file and passes it to all handlers
+func (cw *ConfigWatcher) Reload() error {
+	cw.reloadMu.Lock()
+	defer cw.reloadMu.Unlock()
+
+	data, err := os.ReadFile(cw.configPath)
+	if err != nil {
+		return fmt.Errorf("failed to load new configuration: failed to read config file: %w", err)
+	}
+
+	// Skip the reload if the contents match the applied configuration
+	hash := config.Hash(data)
+	if current := cw.history.Current(); current != nil && current.Hash == hash {
+		cw.logger.Debug("Configuration unchanged (hash %s), skipping reload", shortHash(hash))
+		return nil
+	}
+
+	// Keep a rollback in effect until the file it rolled back from changes
+	if hash == cw.pinnedHash {
+		cw.logger.Info("Configuration file unchanged since the rollback to version %d, skipping reload", cw.history.Current().Original())
+		return nil
+	}
+
 	cw.logger.Info("Configuration file changed, reloading...")
 
 	// Load new configuration
-	newConfig, err := config.LoadConfig(cw.configPath)
+	newConfig, err := config.ParseConfig(data)
 	if err != nil {
-		cw.logger.Error("Failed to load new configuration: %v", err)
-		return
+		return fmt.Errorf("failed to load new configuration: %w", err)
+	}
+
+	if err := cw.apply(newConfig, hash, "file", 0); err != nil {
+		return err
+	}
+	cw.pinnedHash = ""
+
+	cw.logger.Info("Configuration reloaded successfully")
+	return nil
+}
+
+// Rollback re-applies a previously applied configuration version. A version
+// number of 0 rolls back to the version applied before the one in effect, so
+// that repeated rollbacks keep going back. The rolled back configuration is
+// recorded as a new version and stays in effect until the configuration file
+// changes, since the file still holds the configuration rolled back from.
+func (cw *ConfigWatcher) Rollback(number int) (*config.Version, error) {
+	cw.reloadMu.Lock()
+	defer cw.reloadMu.Unlock()
+
+	var target *config.Version
+	var err error
+	if number == 0 {
+		target, err = cw.history.Previous()
+	} else {
+		target, err = cw.history.Get(number)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	restored := target.Original()
+	cw.logger.Info("Rolling back to configuration version %d...", restored)
+	if err := cw.apply(target.Config, target.Hash, fmt.Sprintf("rollback to version %d", restored), restored); err != nil {
+		return nil, err
+	}
+
+	// The file is left untouched, so reloads skip it until it changes
+	if data, err := os.ReadFile(cw.configPath); err == nil {
+		cw.pinnedHash = config.Hash(data)
 	}
 
+	return cw.history.Current(), nil
+}
+
+// Versions returns the retained configuration versions, oldest first
+func (cw *ConfigWatcher) Versions() []config.Version {
+	return cw.history.List()
+}
+
+// Version returns a retained configuration version
+func (cw *ConfigWatcher) Version(number int) (*config.Version, error) {
+	return cw.history.Get(number)
+}
+
+// apply passes the configuration to all handlers and records it as a new
+// version. The caller must hold the reload lock.
+func (cw *ConfigWatcher) apply(newConfig *types.Config, hash, source string, restored int) error {
 	// Notify all handlers
 	cw.mu.RLock()
 	defer cw.mu.RUnlock()
 
+	var errs []error
 	for _, handler := range cw.handlers {
 		if err := handler.OnConfigChange(newConfig); err != nil {
-			cw.logger.Error("Handler failed to process config change: %v", err)
+			errs = append(errs, fmt.Errorf("handler failed to process config change: %w", err))
 		}
 	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
 
-	cw.logger.Info("Configuration reloaded successfully")
+	previous := cw.history.Current()
+	version := cw.history.Record(newConfig, hash, source, restored)
+	cw.logger.Info("Configuration version %d applied (hash %s, %s)", version.Number, shortHash(version.Hash), source)
+	if previous != nil {
+		cw.logger.Info("Configuration changes since version %d: %s", previous.Number, config.DiffConfigs(previous.Config, newConfig))
+	}
+
+	return nil
+}
+
+// shortHash abbreviates a configuration hash for logging
+func shortHash(hash string) string {
+	if len(hash) > 12 {
+		return hash[:12]
+	}
+	return hash
 }
 
 // Close stops watching and cleans up resources
 func (cw *ConfigWatcher) Close() error {
 	cw.logger.Debug("Closing config watcher")
+	if cw.watcher == nil {
+		return nil
+	}
 	return cw.watcher.Close()
 }
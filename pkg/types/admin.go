@@ -0,0 +1,17 @@
+package types
+
+// AdminConfig holds configuration for the admin API listener
+type AdminConfig struct {
+	Enabled bool            `yaml:"enabled"`
+	Host    string          `yaml:"host"`
+	Port    int             `yaml:"port"`
+	Auth    AdminAuthConfig `yaml:"auth"`
+}
+
+// AdminAuthConfig holds the credentials protecting the admin API. Either a
+// bearer token or a username and password for basic authentication must be set.
+type AdminAuthConfig struct {
+	Token    string `yaml:"token,omitempty"`
+	Username string `yaml:"username,omitempty"`
+	Password string `yaml:"password,omitempty"`
+}
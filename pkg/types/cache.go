@@ -0,0 +1,25 @@
+package types
+
+// CacheStoreConfig limits the in-memory store shared by all cached routes
+type CacheStoreConfig struct {
+	MaxSize      ByteSize `yaml:"max_size"`       // Total size of the cached responses, least recently used ones are evicted first
+	MaxEntrySize ByteSize `yaml:"max_entry_size"` // Larger responses are passed through without being cached
+}
+
+// RouteCacheConfig enables caching of the responses of a route. Targets
+// control what is cached and for how long with Cache-Control and Expires.
+type RouteCacheConfig struct {
+	Enabled              bool           `yaml:"enabled"`
+	TTL                  Duration       `yaml:"ttl"`                    // Freshness of responses without Cache-Control max-age or Expires, which are not cached when 0
+	StaleWhileRevalidate Duration       `yaml:"stale_while_revalidate"` // Serve stale responses this long while revalidating in the background, unless the response sets its own
+	StaleIfError         Duration       `yaml:"stale_if_error"`         // Serve stale responses this long when the target fails, unless the response sets its own
+	Key                  CacheKeyConfig `yaml:"key"`
+}
+
+// CacheKeyConfig selects the parts of a request that separate cache entries
+// in addition to the method, host and path
+type CacheKeyConfig struct {
+	Headers  []string `yaml:"headers"`  // Request headers whose values are part of the key
+	Query    []string `yaml:"query"`    // Query parameters that are part of the key, the whole query when empty
+	Consumer bool     `yaml:"consumer"` // Keep separate entries per client credentials, which allows caching authenticated and private responses
+}
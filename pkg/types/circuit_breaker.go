@@ -0,0 +1,14 @@
+package types
+
+// CircuitBreakerConfig stops sending requests to a target after consecutive
+// failures, until a trial request succeeds after the cooldown
+type CircuitBreakerConfig struct {
+	Enabled          bool     `yaml:"enabled"`
+	FailureThreshold int      `yaml:"failure_threshold"` // Consecutive failures that open the circuit
+	Cooldown         Duration `yaml:"cooldown"`          // Time an open circuit rejects requests before a trial request
+	FailureStatuses  []int    `yaml:"failure_statuses"`  // Target response statuses counted as failures, besides connection errors and timeouts
+}
+
+// DefaultCircuitBreakerFailureStatuses lists the response statuses counted as
+// failures unless a service configures its own
+var DefaultCircuitBreakerFailureStatuses = []int{502, 504}
@@ -0,0 +1,34 @@
+package types
+
+// Content encodings used to compress responses and request bodies
+const (
+	EncodingGzip   = "gzip"
+	EncodingBrotli = "br"
+	EncodingZstd   = "zstd"
+)
+
+// CompressionConfig compresses the responses of a route for clients that
+// accept it, unless the target already compressed them
+type CompressionConfig struct {
+	Enabled            bool     `yaml:"enabled"`
+	Algorithms         []string `yaml:"algorithms"`          // zstd, br and gzip in order of preference
+	MinSize            ByteSize `yaml:"min_size"`            // Smaller responses are sent uncompressed
+	ContentTypes       []string `yaml:"content_types"`       // Media types that are compressed, matched by prefix
+	Level              int      `yaml:"level"`               // From 1 (fastest) to 9 (smallest), the default of each algorithm when 0
+	DecompressRequests bool     `yaml:"decompress_requests"` // Decompress gzip, br and zstd request bodies for targets that cannot
+}
+
+// DefaultCompressionContentTypes lists the media types compressed unless a
+// route configures its own
+var DefaultCompressionContentTypes = []string{
+	"text/",
+	"application/json",
+	"application/problem+json",
+	"application/javascript",
+	"application/xml",
+	"application/xhtml+xml",
+	"application/x-ndjson",
+	"application/stream+json",
+	"application/wasm",
+	"image/svg+xml",
+}
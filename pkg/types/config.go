@@ -2,6 +2,10 @@ package types
 
 // Config represents the main configuration structure
 type Config struct {
-	Server   ServerConfig    `yaml:"server"`
-	Services []ServiceConfig `yaml:"services"`
+	Server      ServerConfig       `yaml:"server"`
+	Admin       AdminConfig        `yaml:"admin"`
+	Reload      ReloadConfig       `yaml:"reload"`
+	Services    []ServiceConfig    `yaml:"services"`
+	TCPServices []TCPServiceConfig `yaml:"tcp_services"` // Services proxied at the connection level
+	UDPServices []UDPServiceConfig `yaml:"udp_services"` // Services proxied at the datagram level
 }
@@ -0,0 +1,54 @@
+package types
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Duration is a time.Duration that may also be written as a whole number of
+// seconds, the format route timeouts used before durations were supported.
+// Every duration in the configuration uses it, so that bare numbers mean
+// seconds everywhere.
+type Duration time.Duration
+
+// ParseDuration parses a Go duration string such as "250ms" or "1m30s", or a
+// whole number of seconds
+func ParseDuration(s string) (Duration, error) {
+	if seconds, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return Duration(time.Duration(seconds) * time.Second), nil
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration: %s", s)
+	}
+	return Duration(d), nil
+}
+
+// Std returns the duration as a time.Duration
+func (d Duration) Std() time.Duration {
+	return time.Duration(d)
+}
+
+// String returns the duration formatted like a time.Duration
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface
+func (d *Duration) UnmarshalYAML(value *yaml.Node) error {
+	duration, err := ParseDuration(value.Value)
+	if err != nil {
+		return err
+	}
+	*d = duration
+	return nil
+}
+
+// MarshalYAML implements the yaml.Marshaler interface
+func (d Duration) MarshalYAML() (interface{}, error) {
+	return d.String(), nil
+}
@@ -0,0 +1,39 @@
+package types
+
+// Load balancing strategies of TCP and UDP services
+const (
+	BalanceRoundRobin       = "round_robin"       // Targets take turns
+	BalanceLeastConnections = "least_connections" // The target with the fewest open connections
+)
+
+// TCPServiceConfig proxies raw TCP connections to a set of targets
+type TCPServiceConfig struct {
+	Name              string               `yaml:"name"`
+	Listen            string               `yaml:"listen"`              // Host and port to bind, e.g. "0.0.0.0:5432"
+	Targets           []string             `yaml:"targets"`             // Host and port of every target
+	Balance           string               `yaml:"balance"`             // round_robin or least_connections
+	MaxConnections    int                  `yaml:"max_connections"`     // Maximum number of concurrent client connections, unlimited when 0
+	ConnectTimeout    Duration             `yaml:"connect_timeout"`     // Time allowed to connect to a target
+	CircuitBreaker    CircuitBreakerConfig `yaml:"circuit_breaker"`     // Skip targets that repeatedly fail to connect
+	IdleTimeout       Duration             `yaml:"idle_timeout"`        // Close connections without traffic in either direction for this long
+	SNI               []SNIRoute           `yaml:"sni"`                 // Route TLS connections by server name without terminating TLS
+	ProxyProtocol     ProxyProtocolConfig  `yaml:"proxy_protocol"`      // Client addresses from load balancers in front of the service
+	SendProxyProtocol string               `yaml:"send_proxy_protocol"` // Send a PROXY protocol header of this version (v1 or v2) to the targets
+}
+
+// SNIRoute sends TLS connections for the matching server names to its own targets
+type SNIRoute struct {
+	ServerNames []string `yaml:"server_names"` // Exact names or wildcards such as "*.example.com"
+	Targets     []string `yaml:"targets"`
+}
+
+// UDPServiceConfig proxies UDP datagrams to a set of targets. Datagrams from
+// the same client address form a session bound to a single target.
+type UDPServiceConfig struct {
+	Name        string   `yaml:"name"`
+	Listen      string   `yaml:"listen"`       // Host and port to bind, e.g. "0.0.0.0:514"
+	Targets     []string `yaml:"targets"`      // Host and port of every target
+	Balance     string   `yaml:"balance"`      // round_robin or least_connections
+	MaxSessions int      `yaml:"max_sessions"` // Maximum number of concurrent client sessions, unlimited when 0
+	IdleTimeout Duration `yaml:"idle_timeout"` // End sessions without traffic in either direction for this long
+}
@@ -0,0 +1,126 @@
+package types
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Listener protocols
+const (
+	ProtocolHTTP  = "http"  // HTTP/1.1 over plain TCP
+	ProtocolHTTPS = "https" // HTTP/1.1 and HTTP/2 over TLS
+	ProtocolH2C   = "h2c"   // HTTP/1.1 and HTTP/2 over plain TCP
+)
+
+// DefaultListenerName is the name of the listener created from the server host and port
+const DefaultListenerName = "gateway"
+
+// ListenerConfig holds configuration for a single gateway listener
+type ListenerConfig struct {
+	Name           string              `yaml:"name"`
+	Address        string              `yaml:"address"`  // Host and port to bind, e.g. "0.0.0.0:8443", or a Unix socket such as "unix:///run/aegisgate.sock"
+	Protocol       string              `yaml:"protocol"` // http, https or h2c
+	TLS            TLSConfig           `yaml:"tls"`
+	Timeouts       TimeoutsConfig      `yaml:"timeouts"`         // Unset timeouts are inherited from the server
+	MaxHeaderBytes ByteSize            `yaml:"max_header_bytes"` // Inherited from the server when unset
+	HTTP3          HTTP3Config         `yaml:"http3"`            // HTTP/3 over QUIC, for https listeners
+	ProxyProtocol  ProxyProtocolConfig `yaml:"proxy_protocol"`   // Client addresses from load balancers in front of the listener
+	Socket         UnixSocketConfig    `yaml:"socket"`           // Permissions of the socket file, for Unix socket listeners
+	Services       []string            `yaml:"services"`         // Names of the services served on this listener, all when empty
+}
+
+// TLSConfig holds the TLS settings of an HTTPS listener
+type TLSConfig struct {
+	CertFile     string `yaml:"cert_file"`
+	KeyFile      string `yaml:"key_file"`
+	ClientCAFile string `yaml:"client_ca_file"` // Require client certificates signed by this CA
+	MinVersion   string `yaml:"min_version"`    // 1.2 or 1.3
+}
+
+// HTTP3Config enables HTTP/3 over QUIC next to an HTTPS listener, sharing its
+// routes and certificates
+type HTTP3Config struct {
+	Enabled      bool     `yaml:"enabled"`
+	Address      string   `yaml:"address"`         // UDP host and port to bind, the listener address when empty
+	AltSvcMaxAge Duration `yaml:"alt_svc_max_age"` // How long clients may remember the HTTP/3 endpoint
+}
+
+// UnixSocketConfig sets the permissions of the socket file of a listener
+type UnixSocketConfig struct {
+	Mode  string `yaml:"mode"`  // File mode in octal, e.g. "0660"
+	Owner string `yaml:"owner"` // Name or ID of the user owning the socket
+	Group string `yaml:"group"` // Name or ID of the group owning the socket
+}
+
+// UnixScheme is the scheme of the addresses of Unix sockets
+const UnixScheme = "unix"
+
+// TimeoutsConfig holds the connection timeouts of a listener
+type TimeoutsConfig struct {
+	ReadHeader Duration `yaml:"read_header"` // Time allowed to read the request headers
+	Read       Duration `yaml:"read"`        // Time allowed to read the whole request, including the body
+	Write      Duration `yaml:"write"`       // Time allowed to write the response
+	Idle       Duration `yaml:"idle"`        // Time a keep-alive connection may wait for the next request
+}
+
+// Network returns the network and address to bind, "unix" and the socket
+// path for Unix socket addresses and "tcp" and the address otherwise
+func (l ListenerConfig) Network() (string, string) {
+	if path, ok := UnixSocketPath(l.Address); ok {
+		return "unix", path
+	}
+	return "tcp", l.Address
+}
+
+// UnixSocketPath returns the socket path of a "unix://" address or target URL
+func UnixSocketPath(address string) (string, bool) {
+	return strings.CutPrefix(address, UnixScheme+"://")
+}
+
+// Serves reports whether the listener serves the given service
+func (l ListenerConfig) Serves(service string) bool {
+	return len(l.Services) == 0 || slices.Contains(l.Services, service)
+}
+
+// GetListeners returns the configured listeners, or a single HTTP listener on
+// the server host and port when none are configured. Settings a listener
+// leaves unset are inherited from the server.
+func (s ServerConfig) GetListeners() []ListenerConfig {
+	if len(s.Listeners) == 0 {
+		return []ListenerConfig{{
+			Name:           DefaultListenerName,
+			Address:        fmt.Sprintf("%s:%d", s.Host, s.Port),
+			Protocol:       ProtocolHTTP,
+			Timeouts:       s.Timeouts,
+			MaxHeaderBytes: s.MaxHeaderBytes,
+		}}
+	}
+
+	listeners := make([]ListenerConfig, len(s.Listeners))
+	for i, listener := range s.Listeners {
+		listener.Timeouts = listener.Timeouts.inherit(s.Timeouts)
+		if listener.MaxHeaderBytes == 0 {
+			listener.MaxHeaderBytes = s.MaxHeaderBytes
+		}
+		listeners[i] = listener
+	}
+	return listeners
+}
+
+// inherit returns the timeouts with every unset timeout taken from defaults
+func (t TimeoutsConfig) inherit(defaults TimeoutsConfig) TimeoutsConfig {
+	if t.ReadHeader == 0 {
+		t.ReadHeader = defaults.ReadHeader
+	}
+	if t.Read == 0 {
+		t.Read = defaults.Read
+	}
+	if t.Write == 0 {
+		t.Write = defaults.Write
+	}
+	if t.Idle == 0 {
+		t.Idle = defaults.Idle
+	}
+	return t
+}
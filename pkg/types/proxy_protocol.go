@@ -0,0 +1,15 @@
+package types
+
+// PROXY protocol versions sent to targets
+const (
+	ProxyProtocolV1 = "v1" // Human-readable header
+	ProxyProtocolV2 = "v2" // Binary header
+)
+
+// ProxyProtocolConfig reads the client address from the PROXY protocol header
+// that load balancers in front of the gateway send on every connection
+type ProxyProtocolConfig struct {
+	Enabled       bool     `yaml:"enabled"`
+	TrustedCIDRs  []string `yaml:"trusted_cidrs"`  // Peers that must send a header, connections from others are served as they are
+	HeaderTimeout Duration `yaml:"header_timeout"` // Time allowed to receive the header
+}
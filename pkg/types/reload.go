@@ -0,0 +1,7 @@
+package types
+
+// ReloadConfig holds configuration for reloading the configuration file
+type ReloadConfig struct {
+	Debounce     Duration `yaml:"debounce"`      // Quiet period after the last file event before reloading
+	DisableWatch bool     `yaml:"disable_watch"` // Only reload on SIGHUP or through the admin API
+}
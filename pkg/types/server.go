@@ -2,7 +2,49 @@ package types
 
 // ServerConfig holds server-related configurations
 type ServerConfig struct {
-	Port  int    `yaml:"port"`
-	Host  string `yaml:"host"`
-	Debug bool   `yaml:"debug"`
+	Port           int               `yaml:"port"`
+	Host           string            `yaml:"host"`
+	Listeners      []ListenerConfig  `yaml:"listeners"`        // Replaces host and port when set
+	Timeouts       TimeoutsConfig    `yaml:"timeouts"`         // Defaults for every listener
+	MaxHeaderBytes ByteSize          `yaml:"max_header_bytes"` // Default maximum size of the request headers of every listener
+	MaxHeaderCount int               `yaml:"max_header_count"` // Maximum number of request header fields, unlimited when 0
+	MaxHeaderSize  ByteSize          `yaml:"max_header_size"`  // Maximum size of a single request header field, unlimited when 0
+	MaxBodySize    ByteSize          `yaml:"max_body_size"`    // Default maximum size of request bodies of every route, unlimited when 0
+	Connections    ConnectionsConfig `yaml:"connections"`
+	Debug          bool              `yaml:"debug"`
+	DebugDump      DebugDumpConfig   `yaml:"debug_dump"`
+	Shutdown       ShutdownConfig    `yaml:"shutdown"`
+	Health         HealthConfig      `yaml:"health"`
+	Cache          CacheStoreConfig  `yaml:"cache"` // Store of the routes with caching enabled
+}
+
+// ConnectionsConfig limits the connections accepted across all listeners
+type ConnectionsConfig struct {
+	Max      int `yaml:"max"`        // Maximum number of concurrent connections, unlimited when 0
+	MaxPerIP int `yaml:"max_per_ip"` // Maximum number of concurrent connections from a single client IP, unlimited when 0
+}
+
+// DebugDumpConfig controls what ends up in the request dumps written in debug mode
+type DebugDumpConfig struct {
+	RedactHeaders    []string `yaml:"redact_headers"`     // Header names whose values are masked, in addition to the defaults
+	RedactJSONFields []string `yaml:"redact_json_fields"` // Dot separated JSON field paths whose values are masked
+	RedactPatterns   []string `yaml:"redact_patterns"`    // Regular expressions whose matches are masked anywhere in the dump
+	MaxBodySize      ByteSize `yaml:"max_body_size"`      // Maximum number of body bytes included in a dump
+	SkipContentTypes []string `yaml:"skip_content_types"` // Content type prefixes whose bodies are never dumped, in addition to the defaults
+}
+
+// ShutdownConfig controls the graceful shutdown of the gateway
+type ShutdownConfig struct {
+	PreStopDelay Duration `yaml:"pre_stop_delay"` // Time between failing readiness and closing the listeners
+	DrainTimeout Duration `yaml:"drain_timeout"`  // Maximum time to wait for in-flight requests to complete
+}
+
+// LegacyHealthPath is the health endpoint of earlier versions, served as an
+// alias of the liveness endpoint unless a health path is set to it
+const LegacyHealthPath = "/health"
+
+// HealthConfig holds the paths of the gateway's own health endpoints
+type HealthConfig struct {
+	LivenessPath  string `yaml:"liveness_path"`  // Answers as long as the process is running
+	ReadinessPath string `yaml:"readiness_path"` // Answers only while the gateway is ready to serve traffic
 }
@@ -1,19 +1,110 @@
 package types
 
+// Service protocols
+const (
+	ServiceProtocolHTTP = "http"
+	ServiceProtocolGRPC = "grpc" // Always reached over HTTP/2
+)
+
 // ServiceConfig holds configuration for a single service
 type ServiceConfig struct {
-	Name      string  `yaml:"name"`
-	BasePath  string  `yaml:"base_path"`
-	TargetURL string  `yaml:"target_url"`
-	Routes    []Route `yaml:"routes"`
+	Name           string               `yaml:"name"`
+	BasePath       string               `yaml:"base_path"`
+	TargetURL      string               `yaml:"target_url"` // http://, https:// or unix:// URL of a socket speaking HTTP
+	Protocol       string               `yaml:"protocol"`   // http or grpc
+	Required       bool                 `yaml:"required"`   // The gateway is not ready unless this service has a healthy target
+	Transport      TransportConfig      `yaml:"transport"`
+	CircuitBreaker CircuitBreakerConfig `yaml:"circuit_breaker"`       // Stop sending requests to a failing target
+	Timeout        Duration             `yaml:"timeout,omitempty"`     // Default total timeout of the routes
+	Timeouts       UpstreamTimeouts     `yaml:"timeouts"`              // Default upstream timeouts of the routes
+	Transcoding    TranscodingConfig    `yaml:"transcoding"`           // REST/JSON access to the methods of a gRPC service
+	MaxBodySize    ByteSize             `yaml:"max_body_size"`         // Default maximum size of request bodies of the routes
+	ContentTypes   []string             `yaml:"allowed_content_types"` // Default media types of request bodies the routes accept
+	Routes         []Route              `yaml:"routes"`
 }
 
 // Route represents a single route configuration
 type Route struct {
-	Path      string       `yaml:"path"`
-	Methods   []HTTPMethod `yaml:"methods"`
-	StripPath bool         `yaml:"strip_path"`
-	Timeout   uint         `yaml:"timeout,omitempty"`
+	Path          string                  `yaml:"path"`
+	Methods       []HTTPMethod            `yaml:"methods"`
+	StripPath     bool                    `yaml:"strip_path"`
+	Timeout       Duration                `yaml:"timeout,omitempty"` // Total time allowed for the request, inherited from the service when unset
+	Timeouts      UpstreamTimeouts        `yaml:"timeouts"`          // Unset timeouts are inherited from the service
+	WebSocket     WebSocketConfig         `yaml:"websocket"`
+	FlushInterval Duration                `yaml:"flush_interval"` // Interval for flushing the response to the client, negative to flush after every write
+	GRPC          GRPCMapping             `yaml:"grpc"`           // Transcode JSON requests to this gRPC method
+	Cache         RouteCacheConfig        `yaml:"cache"`
+	Compression   CompressionConfig       `yaml:"compression"`
+	MaxBodySize   ByteSize                `yaml:"max_body_size"`         // Larger request bodies are rejected with 413, inherited from the service and server when unset
+	ContentTypes  []string                `yaml:"allowed_content_types"` // Request bodies of other media types are rejected with 415, inherited from the service when unset
+	Validation    RequestValidationConfig `yaml:"validation"`            // JSON Schemas requests must match, invalid ones are rejected with 400
+}
+
+// UpstreamTimeouts bounds the phases of a request to the target
+type UpstreamTimeouts struct {
+	Connect    Duration `yaml:"connect"`     // Time allowed to connect to the target
+	FirstByte  Duration `yaml:"first_byte"`  // Time allowed between sending the request and receiving the response headers
+	IdleStream Duration `yaml:"idle_stream"` // Time the response body may go without data
+}
+
+// GetTransport returns the transport settings of the service. gRPC services
+// always use HTTP/2.
+func (s ServiceConfig) GetTransport() TransportConfig {
+	transport := s.Transport
+	if s.Protocol == ServiceProtocolGRPC {
+		transport.HTTP2 = true
+	}
+	return transport
+}
+
+// IsTranscoded reports whether requests to the route are transcoded to gRPC
+func (r *Route) IsTranscoded() bool {
+	return r.GRPC.Method != ""
+}
+
+// GetTimeout returns the total timeout of the route, or the default of the service
+func (r *Route) GetTimeout(service ServiceConfig) Duration {
+	if r.Timeout != 0 {
+		return r.Timeout
+	}
+	return service.Timeout
+}
+
+// GetTimeouts returns the upstream timeouts of the route, with unset timeouts
+// taken from the service
+func (r *Route) GetTimeouts(service ServiceConfig) UpstreamTimeouts {
+	timeouts := r.Timeouts
+	if timeouts.Connect == 0 {
+		timeouts.Connect = service.Timeouts.Connect
+	}
+	if timeouts.FirstByte == 0 {
+		timeouts.FirstByte = service.Timeouts.FirstByte
+	}
+	if timeouts.IdleStream == 0 {
+		timeouts.IdleStream = service.Timeouts.IdleStream
+	}
+	return timeouts
+}
+
+// GetMaxBodySize returns the maximum request body size of the route, or the
+// default of the service or server
+func (r *Route) GetMaxBodySize(service ServiceConfig, server ServerConfig) ByteSize {
+	if r.MaxBodySize != 0 {
+		return r.MaxBodySize
+	}
+	if service.MaxBodySize != 0 {
+		return service.MaxBodySize
+	}
+	return server.MaxBodySize
+}
+
+// GetContentTypes returns the media types of request bodies the route
+// accepts, or the default of the service. Any type is accepted when empty.
+func (r *Route) GetContentTypes(service ServiceConfig) []string {
+	if len(r.ContentTypes) > 0 {
+		return r.ContentTypes
+	}
+	return service.ContentTypes
 }
 
 // expandMethods expands any abbreviations in the methods list and removes duplicates
@@ -0,0 +1,70 @@
+package types
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ByteSize represents a size in bytes that can be written in YAML either as
+// a plain integer or with a unit suffix such as "512KB" or "10MB"
+type ByteSize int64
+
+// Byte size units
+const (
+	Byte     ByteSize = 1
+	Kilobyte          = 1024 * Byte
+	Megabyte          = 1024 * Kilobyte
+	Gigabyte          = 1024 * Megabyte
+)
+
+// ParseByteSize converts a string such as "64KB" to a ByteSize
+func ParseByteSize(s string) (ByteSize, error) {
+	value := strings.ToUpper(strings.TrimSpace(s))
+
+	units := []struct {
+		suffix string
+		size   ByteSize
+	}{
+		{"GB", Gigabyte},
+		{"MB", Megabyte},
+		{"KB", Kilobyte},
+		{"G", Gigabyte},
+		{"M", Megabyte},
+		{"K", Kilobyte},
+		{"B", Byte},
+	}
+
+	multiplier := Byte
+	for _, unit := range units {
+		if strings.HasSuffix(value, unit.suffix) {
+			multiplier = unit.size
+			value = strings.TrimSpace(strings.TrimSuffix(value, unit.suffix))
+			break
+		}
+	}
+
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid byte size: %s", s)
+	}
+
+	return ByteSize(n) * multiplier, nil
+}
+
+// String returns the number of bytes as a string
+func (b ByteSize) String() string {
+	return strconv.FormatInt(int64(b), 10)
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface
+func (b *ByteSize) UnmarshalYAML(value *yaml.Node) error {
+	size, err := ParseByteSize(value.Value)
+	if err != nil {
+		return err
+	}
+	*b = size
+	return nil
+}
@@ -0,0 +1,16 @@
+package types
+
+// TranscodingConfig lets REST/JSON clients call the methods of a gRPC service
+type TranscodingConfig struct {
+	DescriptorSet           string   `yaml:"descriptor_set"`            // FileDescriptorSet of the service, compiled with protoc --include_imports
+	Annotations             bool     `yaml:"annotations"`               // Add a route for every google.api.http annotation in the descriptor set
+	Services                []string `yaml:"services"`                  // gRPC services whose annotations are routed, all when empty
+	SkipConflictingBindings bool     `yaml:"skip_conflicting_bindings"` // Skip annotated bindings whose paths conflict with another route instead of failing the load
+}
+
+// GRPCMapping maps the requests of a route to a gRPC method
+type GRPCMapping struct {
+	Method       string `yaml:"method"`        // Fully-qualified method, e.g. library.v1.Library/GetBook
+	Body         string `yaml:"body"`          // Request field the JSON body is decoded into, "*" for the whole request, none when empty
+	ResponseBody string `yaml:"response_body"` // Response field returned as the JSON body, the whole response when empty
+}
@@ -0,0 +1,25 @@
+package types
+
+// TransportConfig tunes the connections from the gateway to the target of a
+// service. Settings left unset use the defaults of Go's HTTP client.
+type TransportConfig struct {
+	DialTimeout           Duration  `yaml:"dial_timeout"`            // Time allowed to establish a TCP connection
+	KeepAlive             Duration  `yaml:"keep_alive"`              // Interval between TCP keep-alive probes
+	TLSHandshakeTimeout   Duration  `yaml:"tls_handshake_timeout"`   // Time allowed for the TLS handshake
+	ResponseHeaderTimeout Duration  `yaml:"response_header_timeout"` // Time allowed for the response headers after the request was written
+	IdleConnTimeout       Duration  `yaml:"idle_conn_timeout"`       // Time an idle connection is kept in the pool
+	MaxIdleConns          int       `yaml:"max_idle_conns"`          // Idle connections kept in the pool
+	MaxIdleConnsPerHost   int       `yaml:"max_idle_conns_per_host"` // Idle connections kept per upstream host
+	MaxConnsPerHost       int       `yaml:"max_conns_per_host"`      // Connections per upstream host, including active ones
+	HTTP2                 bool      `yaml:"http2"`                   // Speak HTTP/2 to the target, over TLS or as h2c for http targets
+	DisableHTTP2          bool      `yaml:"disable_http2"`           // Speak HTTP/1.1 to https targets instead of negotiating HTTP/2
+	DisableCompression    bool      `yaml:"disable_compression"`     // Do not request gzip responses from the target
+	SendProxyProtocol     string    `yaml:"send_proxy_protocol"`     // Send a PROXY protocol header of this version (v1 or v2) on every connection
+	DNS                   DNSConfig `yaml:"dns"`
+}
+
+// DNSConfig controls how the host of a target is resolved
+type DNSConfig struct {
+	Servers         []string `yaml:"servers"`          // DNS servers to query instead of the system resolver
+	RefreshInterval Duration `yaml:"refresh_interval"` // How long resolved addresses are reused before resolving again
+}
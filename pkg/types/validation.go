@@ -0,0 +1,13 @@
+package types
+
+// RequestValidationConfig rejects requests of a route that do not match a
+// JSON Schema before they reach the target
+type RequestValidationConfig struct {
+	BodySchema  string `yaml:"body_schema"`  // JSON Schema file the JSON request body must match
+	QuerySchema string `yaml:"query_schema"` // JSON Schema file the query parameters must match, as an object of their values
+}
+
+// Enabled reports whether requests are validated against any schema
+func (c RequestValidationConfig) Enabled() bool {
+	return c.BodySchema != "" || c.QuerySchema != ""
+}
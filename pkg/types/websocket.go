@@ -0,0 +1,11 @@
+package types
+
+// WebSocketConfig controls WebSocket upgrades on a route
+type WebSocketConfig struct {
+	Enabled        bool     `yaml:"enabled"`         // Allow WebSocket upgrades, which are rejected otherwise
+	IdleTimeout    Duration `yaml:"idle_timeout"`    // Close connections without traffic in either direction for this long
+	MaxLifetime    Duration `yaml:"max_lifetime"`    // Close connections after this long regardless of traffic
+	MaxConnections int      `yaml:"max_connections"` // Maximum number of concurrent connections on the route, unlimited when 0
+	AllowedOrigins []string `yaml:"allowed_origins"` // Origins allowed to connect, any when empty
+	Subprotocols   []string `yaml:"subprotocols"`    // Subprotocols passed to the target, any when empty
+}